@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// byteRateUnits maps the units accepted by --max-bandwidth to their size in
+// bytes, using the same 1024-based units as formatBytes
+var byteRateUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ByteRate is the value of --max-bandwidth in bytes per second. It accepts a
+// plain number of bytes or a size with a unit, e.g. "10MB/s" or "512KB".
+type ByteRate int64
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (r *ByteRate) UnmarshalFlag(value string) error {
+	spec := strings.ToUpper(strings.TrimSpace(value))
+	spec = strings.TrimSuffix(spec, "/S")
+
+	multiplier := 1.0
+	for _, unit := range byteRateUnits {
+		if strings.HasSuffix(spec, unit.suffix) {
+			spec = strings.TrimSpace(strings.TrimSuffix(spec, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(spec, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid bandwidth %q (use e.g. 10MB/s, 512KB/s or a number of bytes)", value)
+	}
+	*r = ByteRate(n * multiplier)
+	return nil
+}
+
+// tokenBucket paces writes across all connections to a byte rate. Callers
+// reserve tokens up front and may drive the bucket into debt, so a message
+// larger than the burst still goes out once enough time has passed.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a bucket that allows a tenth of a second's worth of
+// bytes to burst
+func newTokenBucket(bytesPerSec int64) *tokenBucket {
+	burst := float64(bytesPerSec) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller must
+// wait before sending them
+func (b *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until n bytes may be sent or ctx is done
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	delay := b.reserve(n, time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
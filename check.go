@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lxzan/gws"
+)
+
+// check runs the --check pre-flight: it resolves the target host and completes
+// a single WebSocket handshake without sending any messages
+func (lt *LoadTest) check() error {
+	normalized, err := validateWebSocketURL(lt.opts.URL)
+	if err != nil {
+		return err
+	}
+	parsedURL, err := url.Parse(normalized)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	host := parsedURL.Hostname()
+
+	port := parsedURL.Port()
+	if port == "" {
+		port = "80"
+		if parsedURL.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	if target, ok := lt.resolve[net.JoinHostPort(host, port)]; ok {
+		fmt.Printf("Resolved %s: %s (--resolve)\n", host, target)
+		return lt.checkHandshake()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lt.handshakeTimeout())
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("DNS resolution failed for %s: %w", host, err)
+	}
+	fmt.Printf("Resolved %s: %s\n", host, strings.Join(addrs, ", "))
+
+	return lt.checkHandshake()
+}
+
+// checkHandshake completes one handshake and closes the connection
+func (lt *LoadTest) checkHandshake() error {
+	start := time.Now()
+	client, _, err := lt.dial(&gws.BuiltinEventHandler{})
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	defer client.WriteClose(1000, []byte("check complete"))
+
+	fmt.Printf("Handshake completed in %s", formatDuration(time.Since(start)))
+	if protocol := client.SubProtocol(); protocol != "" {
+		fmt.Printf(" (subprotocol %s)", protocol)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// concurrencyLimiter keeps at most --target-concurrency requests in flight
+// across all connections: a send takes a slot and its response, timeout or
+// failure gives it back, so a new request starts as soon as one completes
+type concurrencyLimiter struct {
+	slots chan struct{}
+
+	mu     sync.Mutex
+	start  time.Time
+	last   time.Time
+	inUse  int
+	peak   int
+	weight float64 // sum of in-flight count × seconds, for the average
+}
+
+// newConcurrencyLimiter creates a limiter with size slots for a test that
+// started at start
+func newConcurrencyLimiter(size int, start time.Time) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, size),
+		start: start,
+		last:  start,
+	}
+}
+
+// acquire waits for a free slot; it reports false if done is closed first.
+// A nil limiter never waits.
+func (c *concurrencyLimiter) acquire(done <-chan struct{}) bool {
+	if c == nil {
+		return true
+	}
+	select {
+	case c.slots <- struct{}{}:
+		c.adjust(1)
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// release gives back n slots
+func (c *concurrencyLimiter) release(n int) {
+	if c == nil || n == 0 {
+		return
+	}
+	for range n {
+		<-c.slots
+	}
+	c.adjust(-n)
+}
+
+// adjust changes the in-flight count, accumulating the time spent at the
+// previous count
+func (c *concurrencyLimiter) adjust(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.weight += float64(c.inUse) * now.Sub(c.last).Seconds()
+	c.last = now
+	c.inUse += delta
+	c.peak = max(c.peak, c.inUse)
+}
+
+// achieved returns the time-weighted average and the peak number of requests
+// in flight up to end
+func (c *concurrencyLimiter) achieved(end time.Time) (float64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := end.Sub(c.start).Seconds()
+	if elapsed <= 0 {
+		return 0, c.peak
+	}
+	weight := c.weight
+	if end.After(c.last) {
+		weight += float64(c.inUse) * end.Sub(c.last).Seconds()
+	}
+	return weight / elapsed, c.peak
+}
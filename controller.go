@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connectionCountChange records the number of connections the test was
+// scaled to and when
+type connectionCountChange struct {
+	At    time.Duration // Offset from the test start
+	Count int
+}
+
+// connectionController starts and stops connection goroutines so the
+// connection count can change while a test runs
+type connectionController struct {
+	lt   *LoadTest
+	wg   *sync.WaitGroup
+	pool chan struct{}
+
+	mu      sync.Mutex
+	cancels []context.CancelFunc // Running connections, oldest first
+	nextID  int
+}
+
+// newConnectionController creates a controller whose connections share pool.
+// Connections added beyond the pool's capacity run without a slot.
+func newConnectionController(lt *LoadTest, wg *sync.WaitGroup, pool chan struct{}) *connectionController {
+	return &connectionController{lt: lt, wg: wg, pool: pool}
+}
+
+// scaleTo starts or stops connections until count are running. The most
+// recently started connections are stopped first. Once the test has ended it
+// does nothing, as the connections are being waited for.
+func (c *connectionController) scaleTo(count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if count == len(c.cancels) || c.lt.ctx.Err() != nil {
+		return
+	}
+
+	for len(c.cancels) < count {
+		c.start()
+	}
+	for len(c.cancels) > count {
+		last := len(c.cancels) - 1
+		c.cancels[last]()
+		c.cancels = c.cancels[:last]
+	}
+
+	c.lt.results.mu.Lock()
+	c.lt.results.ConnectionTimeline = append(c.lt.results.ConnectionTimeline, connectionCountChange{
+		At:    time.Since(c.lt.results.StartTime),
+		Count: count,
+	})
+	c.lt.results.mu.Unlock()
+}
+
+// rampTo starts count connections spread evenly over the --ramp-up window,
+// one every over/count, and records the count once the last has started.
+// It returns early if the test ends first.
+func (c *connectionController) rampTo(count int, over time.Duration) {
+	step := over / time.Duration(count)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-timer.C:
+		case <-c.lt.ctx.Done():
+			return
+		}
+		c.mu.Lock()
+		if c.lt.ctx.Err() != nil {
+			c.mu.Unlock()
+			return
+		}
+		c.start()
+		c.mu.Unlock()
+		timer.Reset(step)
+	}
+
+	c.lt.results.mu.Lock()
+	c.lt.results.ConnectionTimeline = append(c.lt.results.ConnectionTimeline, connectionCountChange{
+		At:    time.Since(c.lt.results.StartTime),
+		Count: count,
+	})
+	c.lt.results.mu.Unlock()
+}
+
+// start launches one connection goroutine; c.mu must be held and the test
+// still running, so the WaitGroup is never added to while it is waited on
+func (c *connectionController) start() {
+	ctx, cancel := context.WithCancel(c.lt.ctx)
+	connID := c.nextID
+	c.nextID++
+	c.cancels = append(c.cancels, cancel)
+
+	pool := c.pool
+	if connID >= cap(c.pool) {
+		pool = nil
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		started := time.Now()
+
+		// Connections closed by --connection-lifetime, or by the server under
+		// --reconnect-on, are replaced until the test ends
+		for replace := true; replace && ctx.Err() == nil; {
+			replace = c.lt.runConnection(ctx, connID, pool)
+		}
+
+		// The slot was expected to be connected until it was scaled down, the
+		// test ended or its ramp-down time came; a connection that failed early
+		// counts as unavailable for the remainder
+		if c.lt.opts.RampDown > 0 {
+			timer := time.NewTimer(time.Until(c.lt.connectionDeadline(connID)))
+			select {
+			case <-ctx.Done():
+			case <-timer.C:
+			}
+			timer.Stop()
+		} else {
+			<-ctx.Done()
+		}
+
+		c.lt.results.mu.Lock()
+		c.lt.results.ExpectedConnTime += time.Since(started)
+		c.lt.results.mu.Unlock()
+	}()
+}
+
+// watch polls a control file once per second and scales to the connection
+// count it contains. The file is only acted on when its value changes. It
+// runs inside the WaitGroup, so the test waits for it to stop scaling.
+func (c *connectionController) watch(path string) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		select {
+		case <-ticker.C:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			value := strings.TrimSpace(string(data))
+			if value == last {
+				continue
+			}
+			last = value
+
+			count, err := parseControlCount(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring control file %s: %v\n", path, err)
+				continue
+			}
+			if c.lt.verbose {
+				log.Printf("Control file: scaling to %d connections", count)
+			}
+			c.scaleTo(count)
+		case <-c.lt.ctx.Done():
+			return
+		}
+	}
+}
+
+// parseControlCount parses the connection count written to a control file
+func parseControlCount(value string) (int, error) {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("expected a non-negative connection count, got %q", value)
+	}
+	return count, nil
+}
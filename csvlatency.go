@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// latencyStreamBuffer is how many samples may queue for the CSV writer
+	// before recording waits for it
+	latencyStreamBuffer = 65536
+
+	// latencyStreamFlush is how often buffered samples are written out
+	latencyStreamFlush = time.Second
+)
+
+// latencySample is one successful request for --csv-latencies
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// latencyStream writes raw latency samples to a CSV file as they are
+// recorded, so long runs keep every sample without holding them in memory
+type latencyStream struct {
+	file    *os.File
+	samples chan latencySample
+	done    chan struct{}
+	err     error
+}
+
+// openLatencyStream creates the CSV file, writes its header and starts the
+// writer
+func openLatencyStream(path string) (*latencyStream, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create latency CSV: %v", err)
+	}
+	s := &latencyStream{
+		file:    file,
+		samples: make(chan latencySample, latencyStreamBuffer),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// record queues one sample; it only blocks when the writer falls behind
+func (s *latencyStream) record(at time.Time, latency time.Duration) {
+	s.samples <- latencySample{at: at, latency: latency}
+}
+
+// run writes queued samples until the stream is closed, flushing the
+// buffered output periodically so an interrupted run keeps most of its data
+func (s *latencyStream) run() {
+	defer close(s.done)
+
+	w := bufio.NewWriter(s.file)
+	fmt.Fprintf(w, "timestamp_unix_ms,latency_us\n")
+	ticker := time.NewTicker(latencyStreamFlush)
+	defer ticker.Stop()
+
+	var line []byte
+	for {
+		select {
+		case sample, ok := <-s.samples:
+			if !ok {
+				s.err = w.Flush()
+				return
+			}
+			line = strconv.AppendInt(line[:0], sample.at.UnixMilli(), 10)
+			line = append(line, ',')
+			line = strconv.AppendInt(line, sample.latency.Microseconds(), 10)
+			line = append(line, '\n')
+			if _, err := w.Write(line); err != nil && s.err == nil {
+				s.err = err
+			}
+		case <-ticker.C:
+			if err := w.Flush(); err != nil && s.err == nil {
+				s.err = err
+			}
+		}
+	}
+}
+
+// close writes the remaining samples and closes the file
+func (s *latencyStream) close() error {
+	close(s.samples)
+	<-s.done
+	if err := s.file.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		return fmt.Errorf("failed to write latency CSV: %v", s.err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lxzan/gws"
+)
+
+const (
+	// debugResponseWait is how long --debug-single waits for a response to
+	// each message when --response-timeout is not set
+	debugResponseWait = 2 * time.Second
+
+	// debugPreviewBytes is how much of each payload the trace shows
+	debugPreviewBytes = 64
+)
+
+// traceHandler prints every event on the --debug-single connection as one
+// line of a sequential trace, timed from the start of the handshake
+type traceHandler struct {
+	start    time.Time
+	received chan struct{}
+	closed   chan struct{}
+	count    atomic.Int64
+}
+
+// trace prints one timestamped line of the trace
+func (h *traceHandler) trace(format string, args ...any) {
+	fmt.Printf("[+%12s] %s\n", time.Since(h.start).Round(time.Microsecond), fmt.Sprintf(format, args...))
+}
+
+func (h *traceHandler) OnOpen(socket *gws.Conn) {
+	// The handshake line already marks the connection as open
+}
+
+func (h *traceHandler) OnClose(socket *gws.Conn, err error) {
+	h.trace("connection closed: %v", err)
+	close(h.closed)
+}
+
+func (h *traceHandler) OnPing(socket *gws.Conn, payload []byte) {
+	h.trace("<- ping   %d B %s", len(payload), previewPayload(gws.OpcodeBinary, payload))
+	if err := socket.WritePong(payload); err != nil {
+		h.trace("-> pong failed: %v", err)
+		return
+	}
+	h.trace("-> pong   %d B", len(payload))
+}
+
+func (h *traceHandler) OnPong(socket *gws.Conn, payload []byte) {
+	h.trace("<- pong   %d B", len(payload))
+}
+
+func (h *traceHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
+	h.count.Add(1)
+	h.trace("<- %-6s %d B %s", opcodeName(message.Opcode), message.Data.Len(), previewPayload(message.Opcode, message.Data.Bytes()))
+	select {
+	case h.received <- struct{}{}:
+	default:
+	}
+}
+
+// runDebugSingle opens a single connection and prints a sequential trace of
+// the handshake and every message sent and received, waiting for the response
+// to each message before sending the next. gws reassembles fragmented frames,
+// so the trace shows whole messages.
+func (lt *LoadTest) runDebugSingle() error {
+	duration, err := time.ParseDuration(lt.opts.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration format: %v", err)
+	}
+	if err := lt.preparePayloads(); err != nil {
+		return err
+	}
+	if lt.command != nil {
+		defer lt.command.stop()
+	}
+
+	wait := debugResponseWait
+	if lt.opts.ResponseTimeout > 0 {
+		wait = lt.opts.ResponseTimeout
+	}
+
+	printBanner("Single Connection Debug Trace")
+	fmt.Printf("\n")
+
+	handler := &traceHandler{
+		start:    time.Now(),
+		received: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	client, resp, err := lt.dial(handler)
+	if resp != nil {
+		printHandshake(resp)
+	}
+	if err != nil {
+		handler.trace("handshake failed: %v", err)
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	handler.trace("handshake complete")
+	go client.ReadLoop()
+
+	// Pause until the server answers, closes, or the wait runs out
+	awaitResponse := func() {
+		select {
+		case <-handler.received:
+		case <-handler.closed:
+		case <-time.After(wait):
+			handler.trace("(no response within %s)", wait)
+		}
+	}
+
+	if lt.opts.FirstMessage != "" {
+		first := []byte(lt.opts.FirstMessage)
+		if err := client.WriteMessage(lt.opcode(), first); err != nil {
+			handler.trace("-> first message failed: %v", err)
+		} else {
+			handler.trace("-> %-6s %d B %s (first message)", opcodeName(lt.opcode()), len(first), previewPayload(lt.opcode(), first))
+			awaitResponse()
+		}
+	}
+
+	deadline := handler.start.Add(duration)
+	sent := 0
+	for i := 0; (lt.opts.Loop == 0 || i < lt.opts.Loop) && time.Now().Before(deadline); i++ {
+		select {
+		case <-handler.closed:
+			return nil
+		default:
+		}
+
+		seq := atomic.AddUint64(&lt.seq, 1)
+		payload, err := lt.buildPayload(0, i, seq)
+		if err != nil {
+			handler.trace("payload #%d failed: %v", i+1, err)
+			continue
+		}
+		if err := client.WriteMessage(lt.opcode(), payload); err != nil {
+			handler.trace("-> message #%d failed: %v", i+1, err)
+			continue
+		}
+		sent++
+		handler.trace("-> %-6s %d B %s", opcodeName(lt.opcode()), len(payload), previewPayload(lt.opcode(), payload))
+		awaitResponse()
+	}
+
+	handler.trace("-> close  1000 debug complete")
+	client.WriteClose(1000, []byte("debug complete"))
+	select {
+	case <-handler.closed:
+	case <-time.After(time.Second):
+		handler.trace("(server did not close the connection within 1s)")
+	}
+
+	fmt.Printf("\nSent %d messages, received %d in %s\n", sent, handler.count.Load(), time.Since(handler.start).Round(time.Microsecond))
+	return nil
+}
+
+// printHandshake prints the upgrade request that was sent and the server's
+// response, headers sorted by name
+func printHandshake(resp *http.Response) {
+	if req := resp.Request; req != nil {
+		fmt.Printf("> %s %s HTTP/1.1\n", req.Method, req.URL.RequestURI())
+		fmt.Printf("> Host: %s\n", req.URL.Host)
+		printHeaders(">", req.Header)
+		fmt.Printf(">\n")
+	}
+	fmt.Printf("< %s %s\n", resp.Proto, resp.Status)
+	printHeaders("<", resp.Header)
+	fmt.Printf("<\n")
+}
+
+// printHeaders prints one "prefix Name: value" line per header value
+func printHeaders(prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Printf("%s %s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// opcodeName returns the trace name of a message opcode
+func opcodeName(opcode gws.Opcode) string {
+	switch opcode {
+	case gws.OpcodeText:
+		return "text"
+	case gws.OpcodeBinary:
+		return "binary"
+	default:
+		return "op" + strconv.Itoa(int(opcode))
+	}
+}
+
+// previewPayload shows the start of a payload: text quoted, binary as hex
+func previewPayload(opcode gws.Opcode, payload []byte) string {
+	truncated := ""
+	if len(payload) > debugPreviewBytes {
+		payload, truncated = payload[:debugPreviewBytes], "..."
+	}
+	if opcode == gws.OpcodeText {
+		return strconv.Quote(string(payload)) + truncated
+	}
+	return hex.EncodeToString(payload) + truncated
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// diagnosticRingSize is how many of the most recent frame events, and of the
+// most recent latencies, --save-on-threshold-breach keeps
+const diagnosticRingSize = 10000
+
+// diagnosticEvent is one traced frame or error, offset from the test start.
+// Conn is -1 for errors, which are recorded by type rather than connection.
+type diagnosticEvent struct {
+	At     time.Duration `json:"at_us"`
+	Conn   int           `json:"conn"`
+	Kind   string        `json:"kind"` // send, receive, error or close
+	Seq    uint64        `json:"seq,omitempty"`
+	Bytes  int           `json:"bytes,omitempty"`
+	Detail string        `json:"detail,omitempty"`
+}
+
+// connectionDiagnostics are the statistics of one closed connection
+type connectionDiagnostics struct {
+	Conn     int           `json:"conn"`
+	Opened   time.Duration `json:"opened_at_us"`
+	Lifetime time.Duration `json:"lifetime_us"`
+	Sent     int64         `json:"sent"`
+	Received int64         `json:"received"`
+}
+
+// diagnostics buffers detail for --save-on-threshold-breach: rings of the
+// latest frame events and latencies, and the statistics of every connection.
+// It is only written out when a pass/fail check fails, so clean runs leave
+// nothing behind.
+type diagnostics struct {
+	mu          sync.Mutex
+	start       time.Time
+	events      []diagnosticEvent
+	next        int
+	wrapped     bool
+	connections []connectionDiagnostics
+
+	latencies      []time.Duration
+	nextLatency    int
+	latencyWrapped bool
+}
+
+// newDiagnostics creates an empty buffer for a test that started at start
+func newDiagnostics(start time.Time) *diagnostics {
+	return &diagnostics{
+		start:     start,
+		events:    make([]diagnosticEvent, diagnosticRingSize),
+		latencies: make([]time.Duration, diagnosticRingSize),
+	}
+}
+
+// trace records a frame event, overwriting the oldest once the ring is full.
+// A nil buffer records nothing.
+func (d *diagnostics) trace(conn int, kind string, seq uint64, bytes int, detail string) {
+	if d == nil {
+		return
+	}
+	at := time.Since(d.start)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events[d.next] = diagnosticEvent{At: at, Conn: conn, Kind: kind, Seq: seq, Bytes: bytes, Detail: detail}
+	d.next++
+	if d.next == len(d.events) {
+		d.next, d.wrapped = 0, true
+	}
+}
+
+// latency records a round-trip latency, overwriting the oldest once the ring
+// is full. A nil buffer records nothing.
+func (d *diagnostics) latency(latency time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.latencies[d.nextLatency] = latency
+	d.nextLatency++
+	if d.nextLatency == len(d.latencies) {
+		d.nextLatency, d.latencyWrapped = 0, true
+	}
+}
+
+// recentLatencies returns the buffered latencies, oldest first
+func (d *diagnostics) recentLatencies() []time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.latencyWrapped {
+		return append([]time.Duration(nil), d.latencies[:d.nextLatency]...)
+	}
+	return append(append([]time.Duration(nil), d.latencies[d.nextLatency:]...), d.latencies[:d.nextLatency]...)
+}
+
+// closed records the statistics of a connection that has closed
+func (d *diagnostics) closed(conn int, opened time.Time, sent, received int64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connections = append(d.connections, connectionDiagnostics{
+		Conn:     conn,
+		Opened:   opened.Sub(d.start),
+		Lifetime: time.Since(opened),
+		Sent:     sent,
+		Received: received,
+	})
+}
+
+// snapshot returns the closed connections and the buffered events, oldest
+// first
+func (d *diagnostics) snapshot() ([]connectionDiagnostics, []diagnosticEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	connections := append([]connectionDiagnostics(nil), d.connections...)
+	if !d.wrapped {
+		return connections, append([]diagnosticEvent(nil), d.events[:d.next]...)
+	}
+	return connections, append(append([]diagnosticEvent(nil), d.events[d.next:]...), d.events[:d.next]...)
+}
+
+// diagnosticReport is the file written by --save-on-threshold-breach; all
+// durations are in microseconds
+type diagnosticReport struct {
+	Reason      string                  `json:"reason"`
+	Start       time.Time               `json:"start"`
+	Connections []connectionDiagnostics `json:"connections"`
+	Events      []diagnosticEvent       `json:"events"`
+	Latencies   []int64                 `json:"latencies_us,omitempty"`
+	ErrorCounts map[string]int          `json:"error_counts"`
+}
+
+// MarshalJSON writes the offset in microseconds
+func (e diagnosticEvent) MarshalJSON() ([]byte, error) {
+	type plain diagnosticEvent
+	e.At /= time.Microsecond
+	return json.Marshal(plain(e))
+}
+
+// MarshalJSON writes the offset and lifetime in microseconds
+func (c connectionDiagnostics) MarshalJSON() ([]byte, error) {
+	type plain connectionDiagnostics
+	c.Opened /= time.Microsecond
+	c.Lifetime /= time.Microsecond
+	return json.Marshal(plain(c))
+}
+
+// writeDiagnostics saves the buffered diagnostics, the latest raw latencies
+// and the error counts to path, with reason saying which check failed
+func (lt *LoadTest) writeDiagnostics(path, reason string) error {
+	report := diagnosticReport{Reason: reason, Start: lt.results.StartTime}
+	report.Connections, report.Events = lt.diagnostics.snapshot()
+	latencies := lt.diagnostics.recentLatencies()
+	report.Latencies = make([]int64, len(latencies))
+	for i, latency := range latencies {
+		report.Latencies[i] = latency.Microseconds()
+	}
+
+	lt.results.mu.Lock()
+	report.ErrorCounts = lt.results.ErrorCounts
+	data, err := json.MarshalIndent(report, "", "  ")
+	lt.results.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode diagnostics: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write diagnostics: %v", err)
+	}
+	return nil
+}
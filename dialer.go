@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxzan/gws"
+)
+
+// socketDialer dials TCP connections for gws and applies the socket tuning
+// options requested on the command line
+type socketDialer struct {
+	net.Dialer
+	noDelay    bool
+	bufferSize int
+	verbose    bool
+	reportOnce *sync.Once
+	resolve    map[string]string
+}
+
+// newSocketDialer creates the dialer used for every connection in a test
+func (lt *LoadTest) newSocketDialer(timeout time.Duration) *socketDialer {
+	return &socketDialer{
+		Dialer:     net.Dialer{Timeout: timeout},
+		noDelay:    lt.opts.TCPNoDelay != "off",
+		bufferSize: lt.opts.SocketBuffer,
+		verbose:    lt.verbose,
+		reportOnce: &lt.reportSocketOnce,
+		resolve:    lt.resolve,
+	}
+}
+
+// parseResolveOverrides parses --resolve entries of the form host:port:ip,
+// like curl's --resolve, into a map from host:port to the ip:port to dial
+func parseResolveOverrides(entries []string) (map[string]string, error) {
+	overrides := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid --resolve %q (use host:port:ip)", entry)
+		}
+		ip := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q: %q is not an IP address", entry, parts[2])
+		}
+		overrides[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(ip, parts[1])
+	}
+	return overrides, nil
+}
+
+// Dial implements gws.Dialer
+func (d *socketDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.connect(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+
+	if err := tcpConn.SetNoDelay(d.noDelay); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.bufferSize > 0 {
+		if err := tcpConn.SetReadBuffer(d.bufferSize); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := tcpConn.SetWriteBuffer(d.bufferSize); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if d.verbose {
+		d.reportOnce.Do(func() {
+			recv, send, ok := socketBufferSizes(tcpConn)
+			if ok {
+				log.Printf("Socket settings: TCP_NODELAY=%t, receive buffer=%d bytes, send buffer=%d bytes", d.noDelay, recv, send)
+			} else {
+				log.Printf("Socket settings: TCP_NODELAY=%t", d.noDelay)
+			}
+		})
+	}
+
+	return conn, nil
+}
+
+// connect resolves the host and connects to its addresses in turn, within
+// the dialer's timeout. Resolving separately keeps DNS failures apart from
+// failures to connect to a resolved address.
+func (d *socketDialer) connect(network, addr string) (net.Conn, error) {
+	// Connect to the overridden address; gws still uses the URL's hostname
+	// for the Host header and TLS SNI
+	if target, ok := d.resolve[addr]; ok {
+		if d.verbose {
+			log.Printf("Resolving %s to %s (--resolve)", addr, target)
+		}
+		addr = target
+	}
+
+	ctx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		conn, err := d.Dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, &connectError{timeout: d.Timeout, err: err}
+		}
+		return conn, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, &resolveError{host: host, err: err}
+	}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = d.Dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, &connectError{timeout: d.Timeout, err: err}
+}
+
+// resolveError is a failure to resolve the host name before connecting
+type resolveError struct {
+	host string
+	err  error
+}
+
+func (e *resolveError) Error() string {
+	return fmt.Sprintf("dns resolution of %s failed: %v", e.host, e.err)
+}
+
+func (e *resolveError) Unwrap() error {
+	return e.err
+}
+
+// connectError is a failure of the TCP connect phase, kept apart from the
+// TLS and WebSocket upgrade that follow it so the slow phase can be told apart
+type connectError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *connectError) Error() string {
+	var netErr net.Error
+	if errors.As(e.err, &netErr) && netErr.Timeout() {
+		return fmt.Sprintf("tcp connect timed out after %s: %v", e.timeout, e.err)
+	}
+	return fmt.Sprintf("tcp connect failed: %v", e.err)
+}
+
+func (e *connectError) Unwrap() error {
+	return e.err
+}
+
+// redirectError is a WebSocket upgrade that the server answered with a 3xx
+// redirect; gws does not follow redirects, so the handshake fails
+type redirectError struct {
+	status   string
+	location string
+}
+
+// newRedirectError describes the redirect in resp, suggesting the WebSocket
+// form of its Location
+func newRedirectError(resp *http.Response) *redirectError {
+	location := resp.Header.Get("Location")
+	if target, err := resp.Location(); err == nil {
+		switch target.Scheme {
+		case "http":
+			target.Scheme = "ws"
+		case "https":
+			target.Scheme = "wss"
+		}
+		location = target.String()
+	}
+	return &redirectError{status: resp.Status, location: location}
+}
+
+func (e *redirectError) Error() string {
+	if e.location == "" {
+		return fmt.Sprintf("server redirected the handshake (%s) without a Location header", e.status)
+	}
+	return fmt.Sprintf("server redirected the handshake (%s) to %s; use that URL instead", e.status, e.location)
+}
+
+func (e *redirectError) Unwrap() error {
+	return gws.ErrHandshake
+}
@@ -0,0 +1,45 @@
+package main
+
+import "math"
+
+// fairnessWarnCoV is the coefficient of variation of per-connection request
+// counts above which the load is reported as unevenly offered
+const fairnessWarnCoV = 0.5
+
+// sendFairness summarizes how evenly requests were spread across connections
+type sendFairness struct {
+	Min    int64
+	Max    int64
+	Mean   float64
+	StdDev float64
+}
+
+// uneven reports whether some connections got far fewer turns than others
+func (f sendFairness) uneven() bool {
+	return f.Mean > 0 && f.StdDev/f.Mean > fairnessWarnCoV
+}
+
+// computeSendFairness returns the distribution of per-connection request
+// counts; it needs at least two connections to say anything
+func computeSendFairness(counts []int64) (sendFairness, bool) {
+	if len(counts) < 2 {
+		return sendFairness{}, false
+	}
+
+	f := sendFairness{Min: counts[0], Max: counts[0]}
+	var sum float64
+	for _, count := range counts {
+		f.Min = min(f.Min, count)
+		f.Max = max(f.Max, count)
+		sum += float64(count)
+	}
+	f.Mean = sum / float64(len(counts))
+
+	var variance float64
+	for _, count := range counts {
+		diff := float64(count) - f.Mean
+		variance += diff * diff
+	}
+	f.StdDev = math.Sqrt(variance / float64(len(counts)))
+	return f, true
+}
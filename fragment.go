@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+
+	"github.com/lxzan/gws"
+)
+
+// fragmentFrames returns how many frames of at most frameSize bytes a payload
+// of n bytes is split into for --frame-size
+func fragmentFrames(n, frameSize int) int {
+	if n == 0 {
+		return 1
+	}
+	return (n + frameSize - 1) / frameSize
+}
+
+// writeFragmented sends payload as one message split into frames of at most
+// frameSize bytes: the first carries the opcode, the rest are continuation
+// frames and only the last has FIN set. gws only writes single-frame
+// messages, so the masked client frames are built here and written to the
+// underlying connection in one call, which keeps them from interleaving with
+// frames gws writes itself (pings, close).
+func writeFragmented(w io.Writer, opcode gws.Opcode, payload []byte, frameSize int) error {
+	frames := fragmentFrames(len(payload), frameSize)
+	buf := make([]byte, 0, len(payload)+frames*14)
+
+	for i := 0; i < frames; i++ {
+		chunk := payload[min(i*frameSize, len(payload)):min((i+1)*frameSize, len(payload))]
+
+		b0 := byte(0) // continuation
+		if i == 0 {
+			b0 = byte(opcode)
+		}
+		if i == frames-1 {
+			b0 |= 0x80 // FIN
+		}
+		buf = appendFrame(buf, b0, chunk)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// appendFrame appends one masked client frame with the given first header
+// byte (FIN and opcode) and payload to buf
+func appendFrame(buf []byte, b0 byte, payload []byte) []byte {
+	buf = append(buf, b0)
+
+	// Client frames are always masked
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, 0x80|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, 0x80|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0x80|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+	var mask [4]byte
+	binary.LittleEndian.PutUint32(mask[:], rand.Uint32())
+	buf = append(buf, mask[:]...)
+	for j, c := range payload {
+		buf = append(buf, c^mask[j%4])
+	}
+	return buf
+}
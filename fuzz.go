@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lxzan/gws"
+)
+
+const (
+	// fuzzMaxFrameSize is the payload size of the oversized-frame case
+	fuzzMaxFrameSize = 16 << 20
+
+	// fuzzPingBurst is how many pings the rapid-ping case sends back to back
+	fuzzPingBurst = 100
+)
+
+// fuzzCase is one adversarial input sent by --fuzz
+type fuzzCase struct {
+	name    string
+	opcode  gws.Opcode
+	payload []byte
+	pings   int // When set, send this many pings instead of a message
+
+	// frameSize, when set, splits the message into continuation frames of
+	// this many bytes; interleavePing also sends a ping after the first
+	frameSize      int
+	interleavePing bool
+}
+
+// fuzzStats records how the server reacted to one fuzz case
+type fuzzStats struct {
+	Sent        int
+	Errors      int
+	Disconnects int
+	Example     string
+}
+
+// builtinFuzzCorpus returns the protocol edge cases sent by --fuzz
+func builtinFuzzCorpus() []fuzzCase {
+	return []fuzzCase{
+		{name: "empty-text", opcode: gws.OpcodeText, payload: []byte{}},
+		{name: "empty-binary", opcode: gws.OpcodeBinary, payload: []byte{}},
+		{name: "invalid-utf8-binary", opcode: gws.OpcodeBinary, payload: []byte{0xff, 0xfe, 0xc3, 0x28, 0xa0, 0xa1, 0xe2, 0x28, 0xa1}},
+		{name: "null-bytes", opcode: gws.OpcodeBinary, payload: make([]byte, 1024)},
+		{name: "control-characters", opcode: gws.OpcodeText, payload: []byte("\x00\x01\x07\x1b[31m\r\n\t\x7f")},
+		{name: "deeply-nested-json", opcode: gws.OpcodeText, payload: []byte(strings.Repeat("[", 10000) + strings.Repeat("]", 10000))},
+		{name: "huge-json-number", opcode: gws.OpcodeText, payload: []byte(`{"n":1` + strings.Repeat("0", 100000) + `}`)},
+		{name: "max-size-frame", opcode: gws.OpcodeBinary, payload: bytes.Repeat([]byte{'A'}, fuzzMaxFrameSize)},
+		{name: "rapid-pings", pings: fuzzPingBurst},
+		{name: "fragmented-text", opcode: gws.OpcodeText, payload: []byte("fragmented text message"), frameSize: 4},
+		{name: "fragmented-split-utf8", opcode: gws.OpcodeText, payload: []byte("h€llo wörld ✓"), frameSize: 1},
+		{name: "fragmented-with-ping", opcode: gws.OpcodeText, payload: []byte("ping between fragments"), frameSize: 8, interleavePing: true},
+	}
+}
+
+// loadFuzzCorpus appends every regular file in dir to the built-in corpus as a
+// binary frame named after the file
+func loadFuzzCorpus(dir string) ([]fuzzCase, error) {
+	corpus := builtinFuzzCorpus()
+	if dir == "" {
+		return corpus, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fuzz corpus: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		payload, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fuzz corpus: %v", err)
+		}
+		corpus = append(corpus, fuzzCase{name: "file:" + entry.Name(), opcode: gws.OpcodeBinary, payload: payload})
+	}
+	return corpus, nil
+}
+
+// writeFuzzCase sends one fuzz case on the connection
+func writeFuzzCase(client *gws.Conn, fc fuzzCase) error {
+	if fc.pings > 0 {
+		for i := 0; i < fc.pings; i++ {
+			if err := client.WritePing(nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case fc.interleavePing:
+		return writeInterleavedPing(client.NetConn(), fc.opcode, fc.payload, fc.frameSize)
+	case fc.frameSize > 0:
+		return writeFragmented(client.NetConn(), fc.opcode, fc.payload, fc.frameSize)
+	}
+	return client.WriteMessage(fc.opcode, fc.payload)
+}
+
+// writeInterleavedPing sends payload split after frameSize bytes, with a ping
+// between the two fragments; control frames may be interleaved with the
+// fragments of a message (RFC 6455, section 5.4)
+func writeInterleavedPing(w io.Writer, opcode gws.Opcode, payload []byte, frameSize int) error {
+	split := min(frameSize, len(payload))
+	buf := appendFrame(nil, byte(opcode), payload[:split])
+	buf = appendFrame(buf, 0x80|byte(gws.OpcodePing), nil)
+	buf = appendFrame(buf, 0x80, payload[split:])
+	_, err := w.Write(buf)
+	return err
+}
+
+// recordFuzzResult counts a fuzz case as sent and records any send error or
+// disconnect attributed to it
+func (lt *LoadTest) recordFuzzResult(name string, sendErr, disconnect error) {
+	lt.results.mu.Lock()
+	defer lt.results.mu.Unlock()
+
+	stats, ok := lt.results.FuzzStats[name]
+	if !ok {
+		stats = &fuzzStats{}
+		lt.results.FuzzStats[name] = stats
+	}
+
+	switch {
+	case disconnect != nil:
+		stats.Disconnects++
+		if stats.Example == "" {
+			stats.Example = disconnect.Error()
+		}
+	case sendErr != nil:
+		stats.Sent++
+		stats.Errors++
+		if stats.Example == "" {
+			stats.Example = sendErr.Error()
+		}
+	default:
+		stats.Sent++
+	}
+}
+
+// printFuzzResults shows which fuzz cases caused errors or disconnects
+func (lt *LoadTest) printFuzzResults() {
+	names := make([]string, 0, len(lt.results.FuzzStats))
+	for name := range lt.results.FuzzStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Fuzz Results:\n")
+	fmt.Printf("  %-24s %8s %8s %12s\n", "Case", "Sent", "Errors", "Disconnects")
+	for _, name := range names {
+		stats := lt.results.FuzzStats[name]
+		fmt.Printf("  %-24s %8d %8d %12d\n", name, stats.Sent, stats.Errors, stats.Disconnects)
+		if stats.Example != "" {
+			example := stats.Example
+			if len(example) > 80 {
+				example = example[:77] + "..."
+			}
+			fmt.Printf("    └─ %s\n", example)
+		}
+	}
+	fmt.Printf("\n")
+}
@@ -1,22 +1,21 @@
 module github.com/SaiNivedh26/ws-load
 
-
 go 1.24
 
 require (
 	github.com/hashicorp/go-metrics v0.5.3
 	github.com/jessevdk/go-flags v1.5.0
+	github.com/klauspost/compress v1.17.5
 	github.com/lxzan/gws v1.8.2
 	github.com/schollz/progressbar/v3 v3.14.2
+	golang.org/x/term v0.17.0
 )
 
 require (
 	github.com/dolthub/maphash v0.1.0 // indirect
 	github.com/hashicorp/go-immutable-radix v1.0.0 // indirect
 	github.com/hashicorp/golang-lru v0.5.0 // indirect
-	github.com/klauspost/compress v1.17.5 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/sys v0.17.0 // indirect
-	golang.org/x/term v0.17.0 // indirect
 )
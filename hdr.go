@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// hdrSignificantFigures is the value precision kept by the histogram
+	hdrSignificantFigures = 3
+
+	// hdrHighestTrackable is the largest latency recorded, in microseconds;
+	// longer latencies are clamped to it
+	hdrHighestTrackable = int64(time.Hour / time.Microsecond)
+
+	// HdrHistogram V2 encoding cookies, with the word-size nibble that marks
+	// zero-run-length encoded counts
+	hdrEncodingCookie           = 0x1c849303 | 0x10
+	hdrCompressedEncodingCookie = 0x1c849304 | 0x10
+)
+
+// hdrHistogram is a High Dynamic Range histogram of latencies in
+// microseconds, laid out like the reference HdrHistogram implementation so it
+// can be exported in the standard histogram log format. Memory use is fixed
+// regardless of how many values are recorded.
+type hdrHistogram struct {
+	unitMagnitude               int
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount          int
+	subBucketMask               int64
+	subBucketCount              int
+	counts                      []int64
+	totalCount                  int64
+	maxValue                    int64
+}
+
+// newHDRHistogram creates an empty histogram tracking 1µs to one hour with
+// three significant figures
+func newHDRHistogram() *hdrHistogram {
+	largestSingleUnit := 2 * int64(math.Pow10(hdrSignificantFigures))
+	subBucketCountMagnitude := int(math.Ceil(math.Log2(float64(largestSingleUnit))))
+
+	h := &hdrHistogram{
+		unitMagnitude:               0, // the lowest discernible value is 1
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketCount:              1 << subBucketCountMagnitude,
+		subBucketHalfCount:          1 << (subBucketCountMagnitude - 1),
+	}
+	h.subBucketMask = int64(h.subBucketCount - 1)
+
+	// Buckets double in range until the highest trackable value fits
+	bucketCount := 1
+	for smallestUntrackable := int64(h.subBucketCount); smallestUntrackable <= hdrHighestTrackable; smallestUntrackable <<= 1 {
+		bucketCount++
+	}
+	h.counts = make([]int64, (bucketCount+1)*h.subBucketHalfCount)
+	return h
+}
+
+// record adds one latency to the histogram
+func (h *hdrHistogram) record(latency time.Duration) {
+	value := int64(latency / time.Microsecond)
+	value = min(max(value, 0), hdrHighestTrackable)
+
+	h.counts[h.countsIndex(value)]++
+	h.totalCount++
+	h.maxValue = max(h.maxValue, value)
+}
+
+// bucketIndex returns the power-of-two bucket holding value
+func (h *hdrHistogram) bucketIndex(value int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask))
+	return pow2Ceiling - h.unitMagnitude - (h.subBucketHalfCountMagnitude + 1)
+}
+
+// countsIndex returns the position of value in the counts array
+func (h *hdrHistogram) countsIndex(value int64) int {
+	bucket := h.bucketIndex(value)
+	subBucket := int(value >> (bucket + h.unitMagnitude))
+	return (bucket+1)<<h.subBucketHalfCountMagnitude + (subBucket - h.subBucketHalfCount)
+}
+
+// valueFromIndex returns the lowest value counted at index
+func (h *hdrHistogram) valueFromIndex(index int) int64 {
+	bucket := (index >> h.subBucketHalfCountMagnitude) - 1
+	subBucket := (index & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= h.subBucketHalfCount
+		bucket = 0
+	}
+	return int64(subBucket) << (bucket + h.unitMagnitude)
+}
+
+// highestEquivalentValue returns the largest value counted together with value
+func (h *hdrHistogram) highestEquivalentValue(value int64) int64 {
+	bucket := h.bucketIndex(value)
+	subBucket := int(value >> (bucket + h.unitMagnitude))
+	if subBucket >= h.subBucketCount {
+		bucket++
+	}
+	size := int64(1) << (h.unitMagnitude + bucket)
+	lowest := int64(subBucket) << (bucket + h.unitMagnitude)
+	return lowest + size - 1
+}
+
+// valueAtPercentile returns the recorded latency at percentile, accurate to
+// the histogram's precision
+func (h *hdrHistogram) valueAtPercentile(percentile float64) time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	target := max(int64(percentile/100*float64(h.totalCount)+0.5), 1)
+
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= target {
+			value := min(h.highestEquivalentValue(h.valueFromIndex(i)), h.maxValue)
+			return time.Duration(value) * time.Microsecond
+		}
+	}
+	return time.Duration(h.maxValue) * time.Microsecond
+}
+
+// encode returns the histogram in the V2 binary encoding: a fixed header
+// followed by zig-zag LEB128 counts, with runs of empty buckets collapsed
+func (h *hdrHistogram) encode() []byte {
+	var payload bytes.Buffer
+	limit := h.countsIndex(h.maxValue) + 1
+	for i := 0; i < limit; {
+		count := h.counts[i]
+		i++
+		if count == 0 {
+			zeros := int64(1)
+			for i < limit && h.counts[i] == 0 {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				putZigZag(&payload, -zeros)
+				continue
+			}
+		}
+		putZigZag(&payload, count)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int32(hdrEncodingCookie))
+	binary.Write(&buf, binary.BigEndian, int32(payload.Len()))
+	binary.Write(&buf, binary.BigEndian, int32(0)) // normalizing index offset
+	binary.Write(&buf, binary.BigEndian, int32(hdrSignificantFigures))
+	binary.Write(&buf, binary.BigEndian, int64(1)) // lowest discernible value
+	binary.Write(&buf, binary.BigEndian, hdrHighestTrackable)
+	binary.Write(&buf, binary.BigEndian, float64(1)) // integer to double conversion ratio
+	buf.Write(payload.Bytes())
+	return buf.Bytes()
+}
+
+// encodeCompressed returns the zlib-compressed V2 encoding used in histogram
+// log files
+func (h *hdrHistogram) encodeCompressed() ([]byte, error) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	if _, err := w.Write(h.encode()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int32(hdrCompressedEncodingCookie))
+	binary.Write(&buf, binary.BigEndian, int32(compressed.Len()))
+	buf.Write(compressed.Bytes())
+	return buf.Bytes(), nil
+}
+
+// putZigZag appends value in the zig-zag LEB128 form of the reference
+// implementation: up to eight 7-bit groups, then a final full byte
+func putZigZag(buf *bytes.Buffer, value int64) {
+	v := uint64((value << 1) ^ (value >> 63))
+	for i := 0; i < 8; i++ {
+		if v>>7 == 0 {
+			buf.WriteByte(byte(v))
+			return
+		}
+		buf.WriteByte(byte(v&0x7f) | 0x80)
+		v >>= 7
+	}
+	buf.WriteByte(byte(v))
+}
+
+// formatHistogramLog renders the histogram as a one-interval HdrHistogram log
+// (format version 1.3). Values are in microseconds; Interval_Max is in
+// milliseconds, as written by the reference log writer.
+func formatHistogramLog(h *hdrHistogram, start time.Time, length time.Duration) (string, error) {
+	encoded, err := h.encodeCompressed()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#[Histogram log format version 1.3]\n")
+	fmt.Fprintf(&b, "#[StartTime: %.3f (seconds since epoch), %s]\n",
+		float64(start.UnixMilli())/1000, start.Format(time.UnixDate))
+	fmt.Fprintf(&b, "#[Values are latencies in microseconds]\n")
+	fmt.Fprintf(&b, "\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n")
+	fmt.Fprintf(&b, "%.3f,%.3f,%.3f,%s\n", 0.0, length.Seconds(), float64(h.maxValue)/1000,
+		base64.StdEncoding.EncodeToString(encoded))
+	return b.String(), nil
+}
+
+// writeHistogramFile writes the latency histogram of the test to path for
+// --hdr-export
+func (lt *LoadTest) writeHistogramFile(path string) error {
+	lt.results.mu.RLock()
+	log, err := formatHistogramLog(lt.results.Histogram, lt.results.StartTime, lt.results.EndTime.Sub(lt.results.StartTime))
+	lt.results.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode latency histogram: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		return fmt.Errorf("failed to write histogram file: %v", err)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,34 +17,73 @@ import (
 
 // TestHistoryEntry represents a single test run entry
 type TestHistoryEntry struct {
-	ID             int            `json:"id"`
-	Timestamp      time.Time      `json:"timestamp"`
-	URL            string         `json:"url"`
-	Duration       string         `json:"duration"`
-	ActualDuration float64        `json:"actual_duration"` // in seconds
-	Connections    int            `json:"connections"`
-	Message        string         `json:"message"`
-	LoopCount      int            `json:"loop_count"`
-	TotalRequests  int64          `json:"total_requests"`
-	SuccessfulReqs int64          `json:"successful_requests"`
-	FailedReqs     int64          `json:"failed_requests"`
-	SuccessRate    float64        `json:"success_rate"`
-	AvgLatency     float64        `json:"avg_latency_ms"`
-	P50Latency     float64        `json:"p50_latency_ms"`
-	RequestsPerSec float64        `json:"requests_per_sec"`
-	Throughput     float64        `json:"throughput_bytes_sec"`
-	BytesSent      int64          `json:"bytes_sent"`
-	BytesReceived  int64          `json:"bytes_received"`
-	ErrorCounts    map[string]int `json:"error_counts"`
+	ID              int            `json:"id"`
+	Timestamp       time.Time      `json:"timestamp"`
+	URL             string         `json:"url"`
+	Duration        string         `json:"duration"`
+	ActualDuration  float64        `json:"actual_duration"` // in seconds
+	Connections     int            `json:"connections"`
+	Message         string         `json:"message"`
+	JSONTemplate    string         `json:"json_template,omitempty"`
+	MessageEncoding string         `json:"message_encoding,omitempty"`
+	MessageFile     string         `json:"message_file,omitempty"`
+	LoopCount       int            `json:"loop_count"`
+	TotalRequests   int64          `json:"total_requests"`
+	SuccessfulReqs  int64          `json:"successful_requests"`
+	FailedReqs      int64          `json:"failed_requests"`
+	SuccessRate     float64        `json:"success_rate"`
+	AvgLatency      float64        `json:"avg_latency_ms"`
+	P50Latency      float64        `json:"p50_latency_ms"`
+	P90Latency      float64        `json:"p90_latency_ms,omitempty"`
+	P95Latency      float64        `json:"p95_latency_ms,omitempty"`
+	P99Latency      float64        `json:"p99_latency_ms,omitempty"`
+	RequestsPerSec  float64        `json:"requests_per_sec"`
+	Throughput      float64        `json:"throughput_bytes_sec"`
+	BytesSent       int64          `json:"bytes_sent"`
+	BytesReceived   int64          `json:"bytes_received"`
+	ErrorCounts     map[string]int `json:"error_counts"`
+	CPUPercent      float64        `json:"generator_cpu_percent,omitempty"`
+	PeakRSS         int64          `json:"generator_peak_rss_bytes,omitempty"`
+	// MessagesReceived counts every message received, including server pushes
+	// that answer no request
+	MessagesReceived int64   `json:"messages_received,omitempty"`
+	ReceivedPerSec   float64 `json:"received_messages_per_sec,omitempty"`
+	// LatencyPercentiles holds the --percentiles of the run in milliseconds,
+	// keyed by label (e.g. "P99.9")
+	LatencyPercentiles map[string]float64 `json:"latency_percentiles_ms,omitempty"`
+	// Latencies are round trips; the write latency, how long a send took to
+	// return, is what avg_latency_ms measured in entries without these
+	AvgWriteLatency float64 `json:"avg_write_latency_ms,omitempty"`
+	P99WriteLatency float64 `json:"p99_write_latency_ms,omitempty"`
+	// ConfigHash identifies the test configuration, so runs of the same
+	// workload can be grouped (see configHash)
+	ConfigHash string `json:"config_hash,omitempty"`
+	// Tag is the --tag the run was labelled with
+	Tag string `json:"tag,omitempty"`
+	// HandshakeHeaders are the response headers of the first successful
+	// handshake, recorded with --capture-headers
+	HandshakeHeaders map[string][]string `json:"handshake_headers,omitempty"`
 }
 
+// clockSkewTolerance is how far in the future an entry timestamp may be before
+// it is reported as clock skew
+const clockSkewTolerance = time.Minute
+
 // TestHistory manages the collection of test history entries
 type TestHistory struct {
 	Entries []TestHistoryEntry `json:"entries"`
 }
 
-// getHistoryFilePath returns the path to the history file in temp directory
+// historyPathEnv overrides the history file location, e.g. to pin it to a
+// shared directory or to isolate tests
+const historyPathEnv = "WS_LOAD_HISTORY_PATH"
+
+// getHistoryFilePath returns the path to the history file: $WS_LOAD_HISTORY_PATH
+// if set, otherwise ws-load-history.json in the temp directory
 func getHistoryFilePath() string {
+	if path := os.Getenv(historyPathEnv); path != "" {
+		return path
+	}
 	tempDir := getTempDirPath()
 	return filepath.Join(tempDir, "ws-load-history.json")
 }
@@ -81,9 +124,38 @@ func loadHistory() (*TestHistory, error) {
 		return nil, fmt.Errorf("failed to parse history file: %v", err)
 	}
 
+	for _, warning := range history.checkClockSkew(time.Now()) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
 	return &history, nil
 }
 
+// checkClockSkew reports entries whose timestamps are in the future or run
+// backwards relative to their IDs, which indicates a skewed clock on the
+// machine that recorded them
+func (th *TestHistory) checkClockSkew(now time.Time) []string {
+	entries := make([]TestHistoryEntry, len(th.Entries))
+	copy(entries, th.Entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	var warnings []string
+	for i, entry := range entries {
+		if entry.Timestamp.After(now.Add(clockSkewTolerance)) {
+			warnings = append(warnings, fmt.Sprintf("test #%d is timestamped in the future (%s)",
+				entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05")))
+		}
+		if i > 0 && entry.Timestamp.Before(entries[i-1].Timestamp) {
+			warnings = append(warnings, fmt.Sprintf("test #%d is timestamped before test #%d; trend charts may be misleading",
+				entry.ID, entries[i-1].ID))
+		}
+	}
+
+	return warnings
+}
+
 // saveHistory saves the test history to file
 func (th *TestHistory) saveHistory() error {
 	historyPath := getHistoryFilePath()
@@ -102,6 +174,31 @@ func (th *TestHistory) saveHistory() error {
 
 // addEntry adds a new test result to the history
 func (th *TestHistory) addEntry(lt *LoadTest) error {
+	entry := newHistoryEntry(lt)
+	entry.ConfigHash = configHash(lt.opts)
+
+	// Generate new ID
+	entry.ID = 1
+	if len(th.Entries) > 0 {
+		entry.ID = th.Entries[len(th.Entries)-1].ID + 1
+	}
+
+	th.Entries = append(th.Entries, entry)
+
+	// Apply the retention policy, if any, now that the new entry is in place
+	if lt.opts.Retention != "" {
+		policy, err := parseRetention(lt.opts.Retention)
+		if err != nil {
+			return err
+		}
+		th.prune(policy, time.Now())
+	}
+
+	return th.saveHistory()
+}
+
+// newHistoryEntry summarizes a finished test as a history entry without an ID
+func newHistoryEntry(lt *LoadTest) TestHistoryEntry {
 	lt.results.mu.RLock()
 	defer lt.results.mu.RUnlock()
 
@@ -111,51 +208,72 @@ func (th *TestHistory) addEntry(lt *LoadTest) error {
 	successfulReqs := lt.results.SuccessfulReqs
 	failedReqs := lt.results.FailedReqs
 
-	var avgLatency, p50Latency float64
-	if successfulReqs > 0 {
-		avgLatency = float64(lt.results.TotalLatency.Nanoseconds()) / float64(successfulReqs) / 1e6 // Convert to milliseconds
-	}
+	var avgLatency, p50Latency, p90Latency, p95Latency, p99Latency float64
+	var percentiles map[string]float64
+	avgLatency = float64(lt.results.avgLatency().Nanoseconds()) / 1e6 // Convert to milliseconds
 
-	if len(lt.results.Latencies) > 0 {
-		// Sort latencies for proper P50 calculation
-		sortedLatencies := make([]time.Duration, len(lt.results.Latencies))
-		copy(sortedLatencies, lt.results.Latencies)
-		sort.Slice(sortedLatencies, func(i, j int) bool {
-			return sortedLatencies[i] < sortedLatencies[j]
-		})
-		p50Latency = float64(sortedLatencies[len(sortedLatencies)/2].Nanoseconds()) / 1e6 // Convert to milliseconds
+	if successfulReqs > 0 {
+		values := lt.latencyPercentiles(append([]float64{50, 90, 95, 99}, lt.opts.Percentiles...))
+		p50Latency = float64(values[0].Nanoseconds()) / 1e6 // Convert to milliseconds
+		p90Latency = float64(values[1].Nanoseconds()) / 1e6
+		p95Latency = float64(values[2].Nanoseconds()) / 1e6
+		p99Latency = float64(values[3].Nanoseconds()) / 1e6
+
+		if len(lt.opts.Percentiles) > 0 {
+			percentiles = make(map[string]float64, len(lt.opts.Percentiles))
+			for i, p := range lt.opts.Percentiles {
+				percentiles[percentileLabel(p)] = float64(values[i+4].Nanoseconds()) / 1e6
+			}
+		}
 	}
 
 	rps := float64(totalRequests) / duration.Seconds()
 	throughput := float64(lt.results.BytesSent+lt.results.BytesReceived) / duration.Seconds()
 	successRate := float64(successfulReqs) / float64(totalRequests) * 100
 
-	// Generate new ID
-	newID := 1
-	if len(th.Entries) > 0 {
-		newID = th.Entries[len(th.Entries)-1].ID + 1
+	entry := TestHistoryEntry{
+		Timestamp:       lt.results.StartTime,
+		URL:             lt.opts.URL,
+		Duration:        lt.opts.Duration,
+		ActualDuration:  duration.Seconds(),
+		Connections:     int(lt.opts.Connections),
+		Message:         lt.opts.Message,
+		JSONTemplate:    lt.opts.JSONTemplate,
+		MessageEncoding: lt.opts.MessageEncoding,
+		MessageFile:     lt.opts.MessageFile,
+		LoopCount:       lt.opts.Loop,
+		TotalRequests:   totalRequests,
+		SuccessfulReqs:  successfulReqs,
+		FailedReqs:      failedReqs,
+		SuccessRate:     successRate,
+		AvgLatency:      avgLatency,
+		P50Latency:      p50Latency,
+		P90Latency:      p90Latency,
+		P95Latency:      p95Latency,
+		P99Latency:      p99Latency,
+		RequestsPerSec:  rps,
+		Throughput:      throughput,
+		BytesSent:       lt.results.BytesSent,
+		BytesReceived:   lt.results.BytesReceived,
+		ErrorCounts:     make(map[string]int),
+		CPUPercent:      lt.results.Resources.CPUPercent,
+		PeakRSS:         lt.results.Resources.PeakRSS,
+		Tag:             lt.opts.Tag,
 	}
 
-	entry := TestHistoryEntry{
-		ID:             newID,
-		Timestamp:      lt.results.StartTime,
-		URL:            lt.opts.URL,
-		Duration:       lt.opts.Duration,
-		ActualDuration: duration.Seconds(),
-		Connections:    lt.opts.Connections,
-		Message:        lt.opts.Message,
-		LoopCount:      lt.opts.Loop,
-		TotalRequests:  totalRequests,
-		SuccessfulReqs: successfulReqs,
-		FailedReqs:     failedReqs,
-		SuccessRate:    successRate,
-		AvgLatency:     avgLatency,
-		P50Latency:     p50Latency,
-		RequestsPerSec: rps,
-		Throughput:     throughput,
-		BytesSent:      lt.results.BytesSent,
-		BytesReceived:  lt.results.BytesReceived,
-		ErrorCounts:    make(map[string]int),
+	entry.LatencyPercentiles = percentiles
+	if lt.results.Writes > 0 {
+		entry.AvgWriteLatency = float64(lt.results.avgWriteLatency().Nanoseconds()) / 1e6
+		entry.P99WriteLatency = float64(lt.results.WriteLatency.valueAtPercentile(99).Nanoseconds()) / 1e6
+	}
+
+	if lt.results.MessagesReceived > 0 {
+		entry.MessagesReceived = lt.results.MessagesReceived
+		entry.ReceivedPerSec = float64(lt.results.MessagesReceived) / duration.Seconds()
+	}
+
+	if len(lt.results.HandshakeHeaders) > 0 {
+		entry.HandshakeHeaders = lt.results.HandshakeHeaders.Clone()
 	}
 
 	// Copy error counts
@@ -163,8 +281,155 @@ func (th *TestHistory) addEntry(lt *LoadTest) error {
 		entry.ErrorCounts[k] = v
 	}
 
-	th.Entries = append(th.Entries, entry)
-	return th.saveHistory()
+	return entry
+}
+
+// applyTo copies the recorded test configuration into opts for --replay
+func (e *TestHistoryEntry) applyTo(opts *TestOptions) {
+	opts.URL = e.URL
+	opts.Duration = e.Duration
+	opts.Connections = ConnectionCount(e.Connections)
+	opts.Message = e.Message
+	opts.MessageEncoding = e.MessageEncoding
+	opts.MessageFile = e.MessageFile
+	opts.JSONTemplate = e.JSONTemplate
+	opts.Loop = e.LoopCount
+}
+
+// printComparison shows how a run differs from an earlier one, as both an
+// absolute delta and a percentage; the labels name the two columns (e.g.
+// "Original" and "Replay")
+func printComparison(w io.Writer, original, current TestHistoryEntry, originalLabel, currentLabel string) {
+	change := func(before, after float64) string {
+		if before == 0 {
+			return "n/a"
+		}
+		return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+	}
+
+	fmt.Fprintf(w, "Comparison with test #%d (%s):\n", original.ID, original.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "  %-18s %12s %12s %14s %10s\n", "Metric", originalLabel, currentLabel, "Delta", "Change")
+	fmt.Fprintf(w, "  %-18s %11.1f%% %11.1f%% %+10.1f pts %10s\n", "Success Rate", original.SuccessRate, current.SuccessRate,
+		current.SuccessRate-original.SuccessRate, change(original.SuccessRate, current.SuccessRate))
+	fmt.Fprintf(w, "  %-18s %12.2f %12.2f %+14.2f %10s\n", "Requests/sec", original.RequestsPerSec, current.RequestsPerSec,
+		current.RequestsPerSec-original.RequestsPerSec, change(original.RequestsPerSec, current.RequestsPerSec))
+	fmt.Fprintf(w, "  %-18s %10.2fms %10.2fms %+12.2fms %10s\n", "Avg Latency", original.AvgLatency, current.AvgLatency,
+		current.AvgLatency-original.AvgLatency, change(original.AvgLatency, current.AvgLatency))
+	fmt.Fprintf(w, "  %-18s %10.2fms %10.2fms %+12.2fms %10s\n", "P50 Latency", original.P50Latency, current.P50Latency,
+		current.P50Latency-original.P50Latency, change(original.P50Latency, current.P50Latency))
+	fmt.Fprintf(w, "  %-18s %10.2fms %10.2fms %+12.2fms %10s\n", "P99 Latency", original.P99Latency, current.P99Latency,
+		current.P99Latency-original.P99Latency, change(original.P99Latency, current.P99Latency))
+	fmt.Fprintf(w, "  %-18s %8.2f B/s %8.2f B/s %+10.2f B/s %10s\n", "Throughput", original.Throughput, current.Throughput,
+		current.Throughput-original.Throughput, change(original.Throughput, current.Throughput))
+	fmt.Fprintf(w, "\n")
+}
+
+// latestForURL returns the most recent entry recorded against url, or nil
+func (th *TestHistory) latestForURL(url string) *TestHistoryEntry {
+	for i := len(th.Entries) - 1; i >= 0; i-- {
+		if th.Entries[i].URL == url {
+			return &th.Entries[i]
+		}
+	}
+	return nil
+}
+
+// findRegressions lists the metrics where current is worse than baseline by
+// more than maxRegression: a drop in requests/sec, a rise in P95 latency
+// (average latency for entries recorded before P95 was stored), or a drop in
+// success rate. In "percent" mode RPS and latency are compared relative to
+// the baseline; in "absolute" mode maxRegression is in req/s and ms. Success
+// rate is always compared in percentage points.
+func findRegressions(baseline, current TestHistoryEntry, maxRegression float64, mode string) []string {
+	var regressions []string
+
+	if baseline.RequestsPerSec > 0 {
+		drop, unit := baseline.RequestsPerSec-current.RequestsPerSec, " req/s"
+		if mode != "absolute" {
+			drop, unit = drop/baseline.RequestsPerSec*100, "%"
+		}
+		if drop > maxRegression {
+			regressions = append(regressions, fmt.Sprintf("requests/sec dropped %.1f%s (%.2f -> %.2f)",
+				drop, unit, baseline.RequestsPerSec, current.RequestsPerSec))
+		}
+	}
+
+	name, before, after := "P95 latency", baseline.P95Latency, current.P95Latency
+	if before == 0 {
+		name, before, after = "avg latency", baseline.AvgLatency, current.AvgLatency
+	}
+	if before > 0 {
+		rise, unit := after-before, "ms"
+		if mode != "absolute" {
+			rise, unit = rise/before*100, "%"
+		}
+		if rise > maxRegression {
+			regressions = append(regressions, fmt.Sprintf("%s rose %.1f%s (%.2fms -> %.2fms)", name, rise, unit, before, after))
+		}
+	}
+
+	if drop := baseline.SuccessRate - current.SuccessRate; drop > maxRegression {
+		regressions = append(regressions, fmt.Sprintf("success rate dropped %.1f pts (%.1f%% -> %.1f%%)",
+			drop, baseline.SuccessRate, current.SuccessRate))
+	}
+
+	return regressions
+}
+
+// retentionPolicy limits how much history is kept, by entry count or by age
+type retentionPolicy struct {
+	maxEntries int
+	maxAge     time.Duration
+}
+
+// parseRetention parses a retention spec: "N" keeps the last N entries and
+// "Nd" keeps entries from the last N days
+func parseRetention(spec string) (retentionPolicy, error) {
+	if days, found := strings.CutSuffix(spec, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return retentionPolicy{}, fmt.Errorf("invalid retention %q (use N entries or Nd days)", spec)
+		}
+		return retentionPolicy{maxAge: time.Duration(n) * 24 * time.Hour}, nil
+	}
+
+	n, err := strconv.Atoi(spec)
+	if err != nil || n <= 0 {
+		return retentionPolicy{}, fmt.Errorf("invalid retention %q (use N entries or Nd days)", spec)
+	}
+	return retentionPolicy{maxEntries: n}, nil
+}
+
+// prune removes entries outside the retention policy and returns how many were
+// removed. Surviving entries keep their IDs.
+func (th *TestHistory) prune(policy retentionPolicy, now time.Time) int {
+	kept := make([]TestHistoryEntry, 0, len(th.Entries))
+	for _, entry := range th.Entries {
+		if policy.maxAge > 0 && now.Sub(entry.Timestamp) > policy.maxAge {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	if policy.maxEntries > 0 && len(kept) > policy.maxEntries {
+		kept = kept[len(kept)-policy.maxEntries:]
+	}
+
+	removed := len(th.Entries) - len(kept)
+	th.Entries = kept
+	return removed
+}
+
+// withConfigHash returns the entries whose config hash starts with prefix,
+// keeping their IDs; entries recorded before hashes were stored never match
+func (th *TestHistory) withConfigHash(prefix string) *TestHistory {
+	filtered := &TestHistory{}
+	for _, entry := range th.Entries {
+		if entry.ConfigHash != "" && strings.HasPrefix(entry.ConfigHash, prefix) {
+			filtered.Entries = append(filtered.Entries, entry)
+		}
+	}
+	return filtered
 }
 
 // getLastNEntries returns the last N entries from history
@@ -181,6 +446,35 @@ func (th *TestHistory) getLastNEntries(n int) []TestHistoryEntry {
 	return th.Entries[start:]
 }
 
+// getEntryByID returns the history entry with the given ID
+func (th *TestHistory) getEntryByID(id int) (*TestHistoryEntry, error) {
+	for i := range th.Entries {
+		if th.Entries[i].ID == id {
+			return &th.Entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no test with ID %d in history", id)
+}
+
+// printEntry displays every recorded field of a single history entry
+func (th *TestHistory) printEntry(id int) error {
+	entry, err := th.getEntryByID(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format test #%d: %v", id, err)
+	}
+
+	fmt.Printf("\n")
+	fmt.Printf("Test #%d - %s\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("%s\n", strings.Repeat("─", 60))
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
 // printHistory displays the test history
 func (th *TestHistory) printHistory(limit int) {
 	if len(th.Entries) == 0 {
@@ -191,9 +485,7 @@ func (th *TestHistory) printHistory(limit int) {
 	entries := th.getLastNEntries(limit)
 
 	fmt.Printf("\n")
-	fmt.Printf("╔══════════════════════════════════════════════════════════════╗\n")
-	fmt.Printf("║                    WebSocket Test History                   ║\n")
-	fmt.Printf("╚══════════════════════════════════════════════════════════════╝\n")
+	printBanner("WebSocket Test History")
 	fmt.Printf("\n")
 
 	for _, entry := range entries {
@@ -201,9 +493,20 @@ func (th *TestHistory) printHistory(limit int) {
 		fmt.Printf("  URL:            %s\n", entry.URL)
 		fmt.Printf("  Duration:       %s (actual: %.2fs)\n", entry.Duration, entry.ActualDuration)
 		fmt.Printf("  Connections:    %d\n", entry.Connections)
+		if entry.ConfigHash != "" {
+			fmt.Printf("  Config Hash:    %s\n", entry.ConfigHash)
+		}
+		if entry.Tag != "" {
+			fmt.Printf("  Tag:            %s\n", entry.Tag)
+		}
 		fmt.Printf("  Success Rate:   %.1f%% (%d/%d)\n", entry.SuccessRate, entry.SuccessfulReqs, entry.TotalRequests)
 		fmt.Printf("  Requests/sec:   %.2f\n", entry.RequestsPerSec)
+		if entry.MessagesReceived > 0 {
+			fmt.Printf("  Received/sec:   %.2f (%d messages)\n", entry.ReceivedPerSec, entry.MessagesReceived)
+		}
 		fmt.Printf("  Avg Latency:    %.2fms\n", entry.AvgLatency)
+		fmt.Printf("  Percentiles:    P50 %s, P90 %s, P95 %s, P99 %s\n", historyLatency(entry.P50Latency),
+			historyLatency(entry.P90Latency), historyLatency(entry.P95Latency), historyLatency(entry.P99Latency))
 		fmt.Printf("  Throughput:     %.2f bytes/sec\n", entry.Throughput)
 		if len(entry.ErrorCounts) > 0 {
 			fmt.Printf("  Errors:         ")
@@ -220,6 +523,161 @@ func (th *TestHistory) printHistory(limit int) {
 	}
 }
 
+// historyLatency formats a latency stored in history, or "-" when the entry
+// predates the field
+func historyLatency(ms float64) string {
+	if ms <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fms", ms)
+}
+
+// printHistoryTable displays the history as a compact table, one row per entry
+func (th *TestHistory) printHistoryTable(limit int) {
+	if len(th.Entries) == 0 {
+		fmt.Println("No test history found.")
+		return
+	}
+
+	entries := th.getLastNEntries(limit)
+
+	fmt.Printf("%5s  %-16s  %-32s  %6s  %8s  %10s  %10s  %10s\n", "ID", "Time", "URL", "Conns", "Success", "RPS", "P95", "P99")
+	fmt.Printf("%s\n", strings.Repeat("─", 112))
+	for _, entry := range entries {
+		fmt.Printf("%5d  %-16s  %-32s  %6d  %7.1f%%  %10.2f  %10s  %10s\n",
+			entry.ID,
+			entry.Timestamp.Format("2006-01-02 15:04"),
+			shortenURL(entry.URL, 32),
+			entry.Connections,
+			entry.SuccessRate,
+			entry.RequestsPerSec,
+			historyLatency(entry.P95Latency),
+			historyLatency(entry.P99Latency))
+	}
+
+	if len(th.Entries) > limit {
+		fmt.Printf("\nShowing last %d of %d total tests\n", len(entries), len(th.Entries))
+	}
+}
+
+// historyExportEntry is a history entry as exported with --export jsonl. Its
+// fields shadow the entry's omitempty ones so every line has the same keys; a
+// percentile the entry never recorded is null rather than 0.
+type historyExportEntry struct {
+	TestHistoryEntry
+	P90Latency         *float64           `json:"p90_latency_ms"`
+	P95Latency         *float64           `json:"p95_latency_ms"`
+	P99Latency         *float64           `json:"p99_latency_ms"`
+	ErrorCounts        map[string]int     `json:"error_counts"`
+	LatencyPercentiles map[string]float64 `json:"latency_percentiles_ms"`
+}
+
+// recordedLatency returns nil for a latency the entry did not record
+func recordedLatency(ms float64) *float64 {
+	if ms == 0 {
+		return nil
+	}
+	return &ms
+}
+
+// exportJSONLines writes the last limit entries to w as newline-delimited
+// JSON, one compact object per entry, for jq, log shippers or bulk loads
+func (th *TestHistory) exportJSONLines(w io.Writer, limit int) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range th.getLastNEntries(limit) {
+		line := historyExportEntry{
+			TestHistoryEntry:   entry,
+			P90Latency:         recordedLatency(entry.P90Latency),
+			P95Latency:         recordedLatency(entry.P95Latency),
+			P99Latency:         recordedLatency(entry.P99Latency),
+			ErrorCounts:        entry.ErrorCounts,
+			LatencyPercentiles: entry.LatencyPercentiles,
+		}
+		if line.ErrorCounts == nil {
+			line.ErrorCounts = map[string]int{}
+		}
+		// Entries recorded before --percentiles have only the fixed fields, and
+		// the oldest of them only P50
+		if line.LatencyPercentiles == nil {
+			line.LatencyPercentiles = map[string]float64{"P50": entry.P50Latency}
+			for name, ms := range map[string]float64{"P90": entry.P90Latency, "P95": entry.P95Latency, "P99": entry.P99Latency} {
+				if ms != 0 {
+					line.LatencyPercentiles[name] = ms
+				}
+			}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return fmt.Errorf("failed to export test #%d: %v", entry.ID, err)
+		}
+	}
+	return nil
+}
+
+// exportCSV writes the last limit entries to w as CSV for spreadsheets: a
+// header row of the JSON field names, then one row per entry in the same
+// order as the fields of TestHistoryEntry. Timestamps are ISO-8601, and maps
+// such as error_counts are flattened into one "key=value;key=value" column.
+func (th *TestHistory) exportCSV(w io.Writer, limit int) error {
+	entryType := reflect.TypeOf(TestHistoryEntry{})
+	header := make([]string, entryType.NumField())
+	for i := range header {
+		header[i], _, _ = strings.Cut(entryType.Field(i).Tag.Get("json"), ",")
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, entry := range th.getLastNEntries(limit) {
+		value := reflect.ValueOf(entry)
+		row := make([]string, len(header))
+		for i := range row {
+			row[i] = csvField(value.Field(i))
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to export history as CSV: %v", err)
+	}
+	return nil
+}
+
+// csvField formats one field of a history entry for exportCSV
+func csvField(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			item := v.MapIndex(key)
+			formatted := fmt.Sprint(item.Interface())
+			if item.Kind() == reflect.Slice {
+				formatted = strings.Join(item.Interface().([]string), ",")
+			}
+			pairs = append(pairs, key.String()+"="+formatted)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ";")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// shortenURL drops the scheme and truncates a URL to fit a table column
+func shortenURL(rawURL string, width int) string {
+	short := strings.TrimPrefix(strings.TrimPrefix(rawURL, "ws://"), "wss://")
+	if len(short) > width {
+		short = short[:width-3] + "..."
+	}
+	return short
+}
+
 // saveChartAsText saves the ASCII chart as a text file
 func saveChartAsText(metric string, chartOutput string, timestamp time.Time) (string, error) {
 	filename := fmt.Sprintf("ws-load-chart-%s-%s.txt",
@@ -247,7 +705,7 @@ func (th *TestHistory) clearHistory() error {
 }
 
 // generateComparisonChart creates a simple ASCII chart comparing metrics and saves as PNG and text
-func (th *TestHistory) generateComparisonChart(metric string, limit int) {
+func (th *TestHistory) generateComparisonChart(metric string, limit int, groupBy, xAxis string) {
 	if len(th.Entries) == 0 {
 		fmt.Println("No test history found.")
 		return
@@ -262,33 +720,57 @@ func (th *TestHistory) generateComparisonChart(metric string, limit int) {
 	timestamp := time.Now()
 
 	fmt.Printf("\n")
-	fmt.Printf("╔══════════════════════════════════════════════════════════════╗\n")
-	fmt.Printf("║                    %s Trend Chart                    ║\n", metric)
-	fmt.Printf("╚══════════════════════════════════════════════════════════════╝\n")
+	printBanner(metric + " Trend Chart")
 	fmt.Printf("\n")
 
 	// Extract values based on metric type
-	var values []float64
-	var labels []string
-
-	for _, entry := range entries {
-		var value float64
+	values := make([]float64, len(entries))
+	for i, entry := range entries {
 		switch metric {
 		case "success-rate":
-			value = entry.SuccessRate
+			values[i] = entry.SuccessRate
 		case "requests-per-sec":
-			value = entry.RequestsPerSec
+			values[i] = entry.RequestsPerSec
 		case "avg-latency":
-			value = entry.AvgLatency
+			values[i] = entry.AvgLatency
+		case "p90-latency":
+			values[i] = entry.P90Latency
+		case "p95-latency":
+			values[i] = entry.P95Latency
+		case "p99-latency":
+			values[i] = entry.P99Latency
 		case "throughput":
-			value = entry.Throughput
+			values[i] = entry.Throughput
 		default:
-			value = entry.SuccessRate
+			values[i] = entry.SuccessRate
 		}
+	}
 
-		values = append(values, value)
-		labels = append(labels, strconv.Itoa(entry.ID))
+	// Size the columns for the widest value, then fit the chart to the
+	// terminal by dropping the oldest runs; when not even two columns fit,
+	// fall back to a plain list
+	labelWidth := chartLabelWidth(values)
+	axisWidth, columnWidth := labelWidth+2, labelWidth+1
+	width := terminalWidth()
+	columns := chartColumns(width, axisWidth, columnWidth)
+	if columns >= 2 && len(entries) > columns {
+		fmt.Printf("Showing the last %d of %d runs to fit a %d-column terminal.\n\n", columns, len(entries), width)
+		entries = entries[len(entries)-columns:]
+		values = values[len(values)-columns:]
 	}
+	minimal := columns < 2
+
+	labels := make([]string, len(entries))
+	for i, entry := range entries {
+		labels[i] = strconv.Itoa(entry.ID)
+	}
+	axisTitle := "Test ID:"
+	if xAxis == "time" {
+		axisTitle, labels = "Time:", timeLabels(entries)
+	}
+
+	// Give each group its own bar marker so interleaved series stay apart
+	groups, groupOf := groupEntries(entries, groupBy)
 
 	// Find min and max for scaling
 	minVal, maxVal := values[0], values[0]
@@ -307,45 +789,64 @@ func (th *TestHistory) generateComparisonChart(metric string, limit int) {
 	// Generate ASCII chart
 	chartHeight := 10
 
-	chartOutput.WriteString("Test ID: ")
-	for i, label := range labels {
-		if i > 0 {
-			chartOutput.WriteString("    ")
+	if minimal {
+		// One line per run: marker (when grouped), label and value
+		for i, label := range labels {
+			marker := ""
+			if groupBy != "" {
+				marker = string([]rune(chartMarkers[groupOf[i]%len(chartMarkers)])[0]) + " "
+			}
+			chartOutput.WriteString(fmt.Sprintf("%s%-5s %.2f\n", marker, label, values[i]))
 		}
-		chartOutput.WriteString(fmt.Sprintf("%-4s", label))
-	}
-	chartOutput.WriteString("\n")
+	} else {
+		gap := strings.Repeat(" ", columnWidth-4)
+		var axis strings.Builder
+		for _, label := range labels {
+			axis.WriteString(fmt.Sprintf("%-*s", columnWidth, label))
+		}
+		chartOutput.WriteString(fmt.Sprintf("%-*s", axisWidth, axisTitle) + strings.TrimRight(axis.String(), " ") + "\n")
 
-	for row := chartHeight; row >= 0; row-- {
-		threshold := minVal + (maxVal-minVal)*float64(row)/float64(chartHeight)
+		for row := chartHeight; row >= 0; row-- {
+			threshold := minVal + (maxVal-minVal)*float64(row)/float64(chartHeight)
 
-		// Print Y-axis label
-		chartOutput.WriteString(fmt.Sprintf("%7.2f |", threshold))
+			// Print Y-axis label
+			chartOutput.WriteString(fmt.Sprintf("%*.2f |", labelWidth, threshold))
 
-		// Print chart bars
-		for i, value := range values {
-			if i > 0 {
-				chartOutput.WriteString("    ")
-			}
+			// Print chart bars
+			for i, value := range values {
+				if i > 0 {
+					chartOutput.WriteString(gap)
+				}
 
-			if value >= threshold {
-				chartOutput.WriteString("████")
-			} else {
-				chartOutput.WriteString("    ")
+				if value >= threshold {
+					chartOutput.WriteString(chartMarkers[groupOf[i]%len(chartMarkers)])
+				} else {
+					chartOutput.WriteString("    ")
+				}
 			}
+			chartOutput.WriteString("\n")
 		}
-		chartOutput.WriteString("\n")
+
+		// Print actual values, aligned under their columns
+		var valueRow strings.Builder
+		for _, value := range values {
+			valueRow.WriteString(fmt.Sprintf("%-*.2f ", labelWidth, value))
+		}
+		chartOutput.WriteString(fmt.Sprintf("%-*s", axisWidth, "Values:") + strings.TrimRight(valueRow.String(), " ") + "\n")
 	}
 
-	// Print actual values
-	chartOutput.WriteString("Values:  ")
-	for i, value := range values {
-		if i > 0 {
-			chartOutput.WriteString("    ")
+	if groupBy != "" {
+		chartOutput.WriteString("\nGroups:\n")
+		for g, name := range groups {
+			runs := 0
+			for _, entryGroup := range groupOf {
+				if entryGroup == g {
+					runs++
+				}
+			}
+			chartOutput.WriteString(fmt.Sprintf("  %s %s (%d runs)\n", chartMarkers[g%len(chartMarkers)], name, runs))
 		}
-		chartOutput.WriteString(fmt.Sprintf("%.2f", value))
 	}
-	chartOutput.WriteString("\n")
 
 	// Display the chart
 	fmt.Print(chartOutput.String())
@@ -361,3 +862,86 @@ func (th *TestHistory) generateComparisonChart(metric string, limit int) {
 
 	fmt.Printf("\n💡 Chart saved to: %s\n", getTempDirPath())
 }
+
+// chartMarkers are the bar fills used for successive groups in a chart
+var chartMarkers = []string{"████", "▓▓▓▓", "▒▒▒▒", "░░░░", "####", "::::"}
+
+// chartLabelWidth is the width of the widest chart value with two decimals,
+// and at least 7, so the axis labels and value row line up with the bars
+func chartLabelWidth(values []float64) int {
+	width := 7
+	for _, value := range values {
+		width = max(width, len(strconv.FormatFloat(value, 'f', 2, 64)))
+	}
+	return width
+}
+
+// chartColumns returns how many runs column characters apart fit in a
+// terminal width wide, after an axis characters wide; 0 means unlimited width
+func chartColumns(width, axis, column int) int {
+	if width <= 0 {
+		return math.MaxInt
+	}
+	if width < axis+4 {
+		return 0
+	}
+	return (width-axis-4)/column + 1
+}
+
+// timeLabels labels entries with when they ran: HH:MM when all runs fall on
+// the same day, otherwise MM-DD. Both fit the narrowest chart columns.
+func timeLabels(entries []TestHistoryEntry) []string {
+	layout := "15:04"
+	first := entries[0].Timestamp.Local()
+	for _, entry := range entries[1:] {
+		if t := entry.Timestamp.Local(); t.YearDay() != first.YearDay() || t.Year() != first.Year() {
+			layout = "01-02"
+			break
+		}
+	}
+
+	labels := make([]string, len(entries))
+	for i, entry := range entries {
+		labels[i] = entry.Timestamp.Local().Format(layout)
+	}
+	return labels
+}
+
+// groupEntries assigns each entry to a group by URL, tag, connection count or
+// config hash. Groups are numbered in order of first appearance; with no
+// grouping every entry belongs to a single unnamed group.
+func groupEntries(entries []TestHistoryEntry, groupBy string) ([]string, []int) {
+	var groups []string
+	groupOf := make([]int, len(entries))
+	index := make(map[string]int)
+
+	for i, entry := range entries {
+		var key string
+		switch groupBy {
+		case "url":
+			key = entry.URL
+		case "tag":
+			key = "tag " + entry.Tag
+			if entry.Tag == "" {
+				key = "untagged"
+			}
+		case "connections":
+			key = fmt.Sprintf("%d connections", entry.Connections)
+		case "config":
+			key = "config " + entry.ConfigHash
+			if entry.ConfigHash == "" {
+				key = "config unknown"
+			}
+		}
+
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, key)
+		}
+		groupOf[i] = g
+	}
+
+	return groups, groupOf
+}
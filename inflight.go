@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxPending bounds the messages a connection keeps awaiting a response, so a
+// server that does not answer every message cannot grow the tracker without
+// limit; past it the oldest message is given up
+const maxPending = 4096
+
+// inflightMessage is a sent message that is still awaiting its response
+type inflightMessage struct {
+	seq    uint64
+	sentAt time.Time
+	digest [sha256.Size]byte
+
+	// expired is set once --response-timeout has counted the message as a
+	// failure; its late response is still consumed to keep pairing in order
+	expired bool
+}
+
+// inflightTracker pairs the messages sent on a single connection with the
+// responses received on it. WebSocket preserves message order within a
+// connection, so responses are matched to sends first-in, first-out. Each
+// connection, including each reconnect, gets its own tracker, so a late
+// response on a replaced connection can never be matched with a newer send.
+type inflightTracker struct {
+	mu      sync.Mutex
+	pending []inflightMessage
+
+	// slots is the --target-concurrency limiter; every message holds a slot
+	// until it is answered, expires, fails to send or is abandoned
+	slots *concurrencyLimiter
+}
+
+// newInflightTracker creates an empty tracker for one connection
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{pending: make([]inflightMessage, 0)}
+}
+
+// push registers a message that is about to be sent; the payload is only
+// hashed for --validate-echo, and nil skips it. When maxPending messages are
+// already waiting, the oldest is dropped and returned.
+func (t *inflightTracker) push(seq uint64, payload []byte) (dropped inflightMessage, overflowed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) >= maxPending {
+		dropped, overflowed = t.pending[0], true
+		t.pending = t.pending[1:]
+		if !dropped.expired {
+			t.slots.release(1)
+		}
+	}
+
+	msg := inflightMessage{seq: seq, sentAt: time.Now()}
+	if payload != nil {
+		msg.digest = sha256.Sum256(payload)
+	}
+	t.pending = append(t.pending, msg)
+	return dropped, overflowed
+}
+
+// discard removes a message that failed to send so it is not paired with a
+// later response
+func (t *inflightTracker) discard(seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.pending) - 1; i >= 0; i-- {
+		if t.pending[i].seq == seq {
+			if !t.pending[i].expired {
+				t.slots.release(1)
+			}
+			t.pending = append(t.pending[:i], t.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// pop returns the oldest message still awaiting a response
+func (t *inflightTracker) pop() (inflightMessage, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return inflightMessage{}, false
+	}
+	msg := t.pending[0]
+	t.pending = t.pending[1:]
+	if !msg.expired {
+		t.slots.release(1)
+	}
+	return msg, true
+}
+
+// expire marks messages sent before cutoff as expired and returns how many
+// were newly marked
+func (t *inflightTracker) expire(cutoff time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := 0
+	for i := range t.pending {
+		if t.pending[i].expired {
+			continue
+		}
+		if !t.pending[i].sentAt.Before(cutoff) {
+			break
+		}
+		t.pending[i].expired = true
+		expired++
+	}
+	t.slots.release(expired)
+	return expired
+}
+
+// oldest returns when the oldest message still awaiting a response was sent,
+// ignoring expired ones
+func (t *inflightTracker) oldest() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, msg := range t.pending {
+		if !msg.expired {
+			return msg.sentAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// abandon drops every pending message, e.g. when the connection is found to
+// be dead, and returns how many had not already been counted as failures
+func (t *inflightTracker) abandon() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	abandoned := 0
+	for _, msg := range t.pending {
+		if !msg.expired {
+			abandoned++
+		}
+	}
+	t.pending = t.pending[:0]
+	t.slots.release(abandoned)
+	return abandoned
+}
+
+// count returns the number of messages still awaiting a response, excluding
+// expired ones that have already been counted as failures
+func (t *inflightTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	waiting := 0
+	for _, msg := range t.pending {
+		if !msg.expired {
+			waiting++
+		}
+	}
+	return waiting
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// autoConnectionsPerCPU is how many connections --connections auto opens per CPU
+	autoConnectionsPerCPU = 256
+
+	// reservedFileDescriptors are kept free for stdio, DNS, history files, etc.
+	reservedFileDescriptors = 64
+)
+
+// ConnectionCount is the value of --connections. It accepts a positive number
+// or "auto" to size the test to the machine it runs on.
+type ConnectionCount int
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (c *ConnectionCount) UnmarshalFlag(value string) error {
+	if strings.EqualFold(value, "auto") {
+		count, reason := autoConnectionCount()
+		fmt.Fprintf(os.Stderr, "Auto-selected %d connections (%s)\n", count, reason)
+		*c = ConnectionCount(count)
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid connection count %q (use a number or \"auto\")", value)
+	}
+	*c = ConnectionCount(n)
+	return nil
+}
+
+// autoConnectionCount picks a connection count from the CPU count and the
+// process file descriptor limit, returning the count and how it was chosen
+func autoConnectionCount() (int, string) {
+	procs := runtime.GOMAXPROCS(0)
+	count := procs * autoConnectionsPerCPU
+	reason := fmt.Sprintf("%d CPUs x %d", procs, autoConnectionsPerCPU)
+
+	if limit, ok := fileDescriptorLimit(); ok {
+		available := int(limit) - reservedFileDescriptors
+		if limit > uint64(1<<31) {
+			available = count
+		}
+		if available < count {
+			count = available
+			reason = fmt.Sprintf("file descriptor limit %d minus %d reserved", limit, reservedFileDescriptors)
+		}
+	}
+
+	if count < 1 {
+		count = 1
+	}
+	return count, reason
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+// fileDescriptorLimit reports that Windows has no per-process descriptor limit
+// comparable to RLIMIT_NOFILE
+func fileDescriptorLimit() (uint64, bool) {
+	return 0, false
+}
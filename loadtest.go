@@ -2,10 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/hashicorp/go-metrics"
@@ -13,6 +30,9 @@ import (
 	"github.com/schollz/progressbar/v3"
 )
 
+// defaultHandshakeTimeout applies when no handshake timeout is configured
+const defaultHandshakeTimeout = 10 * time.Second
+
 // Error categories for better error analysis
 const (
 	ErrorCategoryTimeout            = "timeout"
@@ -21,8 +41,13 @@ const (
 	ErrorCategoryInvalidData        = "invalid_data"
 	ErrorCategoryAuthFailure        = "authentication_failure"
 	ErrorCategoryNetworkError       = "network_error"
+	ErrorCategoryDNS                = "dns_failure"
 	ErrorCategoryProtocolError      = "protocol_error"
 	ErrorCategoryResourceExhaustion = "resource_exhaustion"
+	ErrorCategorySubprotocol        = "subprotocol_mismatch"
+	ErrorCategoryRedirect           = "handshake_redirect"
+	ErrorCategoryFanOut             = "fan_out_incomplete"
+	ErrorCategoryGenerator          = "generator_failure"
 	ErrorCategoryUnknown            = "unknown"
 )
 
@@ -31,6 +56,19 @@ type ErrorCategoryInfo struct {
 	Count       int
 	Description string
 	Examples    []string
+	FirstSeen   time.Duration // Offset from the test start of the first occurrence
+}
+
+// record adds n occurrences of the category, keeping up to three examples and
+// the offset of the first occurrence
+func (info *ErrorCategoryInfo) record(n int, example string, offset time.Duration) {
+	if info.Count == 0 {
+		info.FirstSeen = offset
+	}
+	info.Count += n
+	if len(info.Examples) < 3 {
+		info.Examples = append(info.Examples, example)
+	}
 }
 
 // initializeErrorCategories creates and initializes error categories with descriptions
@@ -69,7 +107,13 @@ func initializeErrorCategories() map[string]*ErrorCategoryInfo {
 
 	categories[ErrorCategoryNetworkError] = &ErrorCategoryInfo{
 		Count:       0,
-		Description: "Network-related errors (DNS, routing, etc.)",
+		Description: "Network-related errors (routing, resets, etc.)",
+		Examples:    make([]string, 0),
+	}
+
+	categories[ErrorCategoryDNS] = &ErrorCategoryInfo{
+		Count:       0,
+		Description: "Host name could not be resolved",
 		Examples:    make([]string, 0),
 	}
 
@@ -85,6 +129,30 @@ func initializeErrorCategories() map[string]*ErrorCategoryInfo {
 		Examples:    make([]string, 0),
 	}
 
+	categories[ErrorCategorySubprotocol] = &ErrorCategoryInfo{
+		Count:       0,
+		Description: "Server did not select any of the requested subprotocols",
+		Examples:    make([]string, 0),
+	}
+
+	categories[ErrorCategoryRedirect] = &ErrorCategoryInfo{
+		Count:       0,
+		Description: "Server answered the WebSocket upgrade with an HTTP redirect",
+		Examples:    make([]string, 0),
+	}
+
+	categories[ErrorCategoryFanOut] = &ErrorCategoryInfo{
+		Count:       0,
+		Description: "Connections that did not receive the --expect-received number of messages",
+		Examples:    make([]string, 0),
+	}
+
+	categories[ErrorCategoryGenerator] = &ErrorCategoryInfo{
+		Count:       0,
+		Description: "The --message-command generator failed or was too slow to produce a payload",
+		Examples:    make([]string, 0),
+	}
+
 	categories[ErrorCategoryUnknown] = &ErrorCategoryInfo{
 		Count:       0,
 		Description: "Uncategorized or unknown errors",
@@ -94,12 +162,18 @@ func initializeErrorCategories() map[string]*ErrorCategoryInfo {
 	return categories
 }
 
-// categorizeError determines the category of an error based on its message and type
+// categorizeError determines the category of an error, from its type where
+// it has one and otherwise from its message
 func categorizeError(err error) string {
 	if err == nil {
 		return ErrorCategoryUnknown
 	}
+	if category, ok := categorizeTypedError(err); ok {
+		return category
+	}
 
+	// Untyped errors, e.g. from a server or library that formats its own,
+	// can only be told apart by their message
 	errMsg := strings.ToLower(err.Error())
 
 	// Timeout errors
@@ -118,10 +192,8 @@ func categorizeError(err error) string {
 	}
 
 	// Network errors
-	if strings.Contains(errMsg, "no such host") ||
-		strings.Contains(errMsg, "network unreachable") ||
-		strings.Contains(errMsg, "no route to host") ||
-		strings.Contains(errMsg, "dns") {
+	if strings.Contains(errMsg, "network unreachable") ||
+		strings.Contains(errMsg, "no route to host") {
 		return ErrorCategoryNetworkError
 	}
 
@@ -169,6 +241,81 @@ func categorizeError(err error) string {
 	return ErrorCategoryUnknown
 }
 
+// categorizeTypedError classifies err by the error values and types it
+// wraps, which unlike its message cannot be confused by a host name or a
+// close reason that happens to contain a trigger word
+func categorizeTypedError(err error) (string, bool) {
+	// A failed lookup is a DNS failure even when it timed out
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorCategoryDNS, true
+	}
+
+	// Redirects and subprotocol mismatches would otherwise look like generic
+	// handshake errors, but each needs its own fix
+	var redirect *redirectError
+	if errors.As(err, &redirect) {
+		return ErrorCategoryRedirect, true
+	}
+	if errors.Is(err, gws.ErrSubprotocolNegotiation) {
+		return ErrorCategorySubprotocol, true
+	}
+
+	// Deadlines set on the connection, dial timeouts and expired contexts
+	var netErr net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorCategoryTimeout, true
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorCategoryConnectionRefused, true
+	case errors.Is(err, gws.ErrUnauthorized):
+		return ErrorCategoryAuthFailure, true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETDOWN),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorCategoryNetworkError, true
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE), errors.Is(err, syscall.ENOBUFS),
+		errors.Is(err, syscall.ENOMEM), errors.Is(err, syscall.EADDRNOTAVAIL):
+		return ErrorCategoryResourceExhaustion, true
+	case errors.Is(err, gws.ErrTextEncoding):
+		return ErrorCategoryInvalidData, true
+	case errors.Is(err, gws.ErrHandshake), errors.Is(err, gws.ErrCompressionNegotiation), errors.Is(err, gws.ErrUnsupportedProtocol):
+		return ErrorCategoryProtocolError, true
+	}
+
+	// TLS handshake and certificate failures
+	var (
+		recordErr *tls.RecordHeaderError
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+		authority x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return ErrorCategoryProtocolError, true
+	}
+
+	// Close frames carry a status code that says what the server objected to
+	var closeErr *gws.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case 1002:
+			return ErrorCategoryProtocolError, true
+		case 1003, 1007:
+			return ErrorCategoryInvalidData, true
+		case 1013:
+			return ErrorCategoryResourceExhaustion, true
+		}
+	}
+
+	return "", false
+}
+
 // LoadTest represents a WebSocket load test
 type LoadTest struct {
 	opts     *TestOptions
@@ -178,35 +325,183 @@ type LoadTest struct {
 	cancel   context.CancelFunc
 	progress *progressbar.ProgressBar
 	verbose  bool
+	seq      uint64
+	template *template.Template
+	sizeDist *sizeDistribution
+	deadline time.Time
+	limiter  *tokenBucket
+	resolve  map[string]string
+	remote   *remoteWriter
+	message  []byte
+	fuzz     []fuzzCase
+	command  *commandGenerator
+	requests *requestQueue
+	messages []corpusMessage
+	pause    *pauseGate
+	slots    *concurrencyLimiter
+	rampedUp atomic.Bool // Every --ramp-up connection has started
+
+	// unpaired counts responses that arrived with no send awaiting one and
+	// sends given up by a full in-flight tracker
+	unpaired atomic.Int64
+
+	// diagnostics buffers frame traces for --save-on-threshold-breach
+	diagnostics *diagnostics
+
+	reportSocketOnce   sync.Once
+	captureHeadersOnce sync.Once
+
+	// Connect-phase guard for --max-connect-failures
+	dialAttempts    atomic.Int64
+	connectFailures atomic.Int64
+	abortOnce       sync.Once
+	abortReason     string
 }
 
 // TestResults contains aggregated test results
 type TestResults struct {
-	mu               sync.RWMutex
-	TotalRequests    int64
-	SuccessfulReqs   int64
-	FailedReqs       int64
-	TotalLatency     time.Duration
-	Latencies        []time.Duration
-	PeakResponseTime time.Duration
-	StartTime        time.Time
-	EndTime          time.Time
-	BytesSent        int64
-	BytesReceived    int64
-	ErrorCounts      map[string]int
-	StatusCodeCount  map[int]int
-	ErrorCategories  map[string]*ErrorCategoryInfo
+	mu                 sync.RWMutex
+	TotalRequests      int64
+	SuccessfulReqs     int64
+	FailedReqs         int64
+	TotalLatency       time.Duration
+	RoundTrips         int64
+	LatencyStream      *latencyStream
+	MessageLatencies   [][]time.Duration
+	Histogram          *hdrHistogram
+	PeakResponseTime   time.Duration
+	StartTime          time.Time
+	EndTime            time.Time
+	BytesSent          int64
+	BytesReceived      int64
+	MessagesReceived   int64
+	InterArrivals      []time.Duration
+	DroppedMessages    int64
+	EstablishedConns   int64
+	HandshakeTimeouts  int64
+	ShortConnections   int64
+	RedirectLocation   string
+	ServerCloses       int64
+	Reconnects         int64
+	Timeline           []timelinePoint
+	Resources          resourceUsage
+	ConnLifetimes      []time.Duration
+	ConnRequests       []int64
+	ConnectedTime      time.Duration
+	FuzzStats          map[string]*fuzzStats
+	ExpectedConnTime   time.Duration
+	HandshakeHeaders   http.Header
+	ConnectionTimeline []connectionCountChange
+	CancelledReqs      int64
+	EchoesVerified     int64
+	IntegrityErrors    int64
+	IntegrityExample   string
+	FragmentedMsgs     int64
+	FragmentFrames     int64
+	ErrorCounts        map[string]int
+	StatusCodeCount    map[int]int
+	ErrorCategories    map[string]*ErrorCategoryInfo
+
+	// The write latency, how long WriteMessage took to return, is kept apart
+	// from the round trip recorded in Histogram
+	Writes            int64
+	TotalWriteLatency time.Duration
+	WriteLatency      *hdrHistogram
+}
+
+// sortedErrorCategories returns the error category names in a stable order
+func (r *TestResults) sortedErrorCategories() []string {
+	categories := make([]string, 0, len(r.ErrorCategories))
+	for category := range r.ErrorCategories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// handshakeTimeoutHintShare is the share of failures that must be handshake
+// timeouts before the results suggest raising --handshake-timeout
+const handshakeTimeoutHintShare = 0.2
+
+// handshakeTimeoutShare returns the fraction of failures that were handshake
+// timeouts, and whether it is large enough to be worth a hint
+func (r *TestResults) handshakeTimeoutShare() (float64, bool) {
+	if r.FailedReqs == 0 || r.HandshakeTimeouts == 0 {
+		return 0, false
+	}
+	share := float64(r.HandshakeTimeouts) / float64(r.FailedReqs)
+	return share, share >= handshakeTimeoutHintShare
+}
+
+// errorBudgetConsumed returns the percentage of the error budget of an
+// availability SLO (in percent) that the failed requests used up; the budget
+// is the share of requests the SLO allows to fail
+func (r *TestResults) errorBudgetConsumed(slo float64) (float64, bool) {
+	if r.TotalRequests == 0 {
+		return 0, false
+	}
+	allowed := float64(r.TotalRequests) * (100 - slo) / 100
+	// Round off float error (100 - 99.9 is not exactly 0.1), so a budget
+	// spent exactly is not reported as exceeded
+	return math.Round(float64(r.FailedReqs)/allowed*1e8) / 1e6, true
+}
+
+// connectionAvailability returns the percentage of the expected connection
+// time during which connections were actually open
+func (r *TestResults) connectionAvailability() (float64, bool) {
+	if r.ExpectedConnTime <= 0 {
+		return 0, false
+	}
+	availability := float64(r.ConnectedTime) / float64(r.ExpectedConnTime) * 100
+	if availability > 100 {
+		availability = 100
+	}
+	return availability, true
 }
 
 // WebSocketEventHandler implements the gws.Event interface
 type WebSocketEventHandler struct {
-	connID int
-	lt     *LoadTest
+	connID   int
+	lt       *LoadTest
+	inflight *inflightTracker
+
+	// firstResponse is closed when the server answers --first-message
+	firstResponse chan struct{}
+	awaitingFirst atomic.Bool
+
+	// lastFuzzCase is the name of the last --fuzz case sent; closing is set
+	// once the client starts closing so only server-side disconnects are
+	// attributed to it
+	lastFuzzCase atomic.Value
+	closing      atomic.Bool
+
+	// sent counts successful sends, for the per-connection fairness report,
+	// and received counts data messages for --expect-received
+	sent     atomic.Int64
+	received atomic.Int64
+
+	// lastMessage is when the previous message arrived, for inter-arrival
+	// times in --send-on-connect-only mode; only the read loop touches it
+	lastMessage time.Time
+
+	// lastReceived is when data last arrived (UnixNano), and dead is closed
+	// once --idle-timeout declares the connection half-open
+	lastReceived atomic.Int64
+	dead         chan struct{}
+
+	// serverClosed is closed when the server ends the connection while it is
+	// in use, with the reason in closeErr, for --reconnect-on
+	serverClosed chan struct{}
+	closeErr     error
 }
 
 func (h *WebSocketEventHandler) OnOpen(socket *gws.Conn) {
 	if h.lt.verbose {
-		log.Printf("Connection %d opened", h.connID)
+		if protocol := socket.SubProtocol(); protocol != "" {
+			log.Printf("Connection %d opened (subprotocol %s)", h.connID, protocol)
+		} else {
+			log.Printf("Connection %d opened", h.connID)
+		}
 	}
 }
 
@@ -214,6 +509,29 @@ func (h *WebSocketEventHandler) OnClose(socket *gws.Conn, err error) {
 	if h.lt.verbose {
 		log.Printf("Connection %d closed: %v", h.connID, err)
 	}
+	if h.lt.diagnostics != nil {
+		h.lt.diagnostics.trace(h.connID, "close", 0, 0, fmt.Sprint(err))
+	}
+
+	// A read deadline firing means the server stopped responding
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		h.lt.recordError(fmt.Sprintf("read_timeout_%d", h.connID), err)
+	}
+
+	if h.serverClosed != nil && !h.closing.Load() {
+		h.closeErr = err
+		close(h.serverClosed)
+	}
+
+	// Attribute server-side disconnects to the fuzz case that provoked them
+	if h.lt.fuzz != nil && !h.closing.Load() && h.lt.ctx.Err() == nil {
+		if name, ok := h.lastFuzzCase.Load().(string); ok {
+			if err == nil {
+				err = errors.New("connection closed")
+			}
+			h.lt.recordFuzzResult(name, nil, err)
+		}
+	}
 }
 
 func (h *WebSocketEventHandler) OnPing(socket *gws.Conn, payload []byte) {
@@ -221,86 +539,334 @@ func (h *WebSocketEventHandler) OnPing(socket *gws.Conn, payload []byte) {
 }
 
 func (h *WebSocketEventHandler) OnPong(socket *gws.Conn, payload []byte) {
-	// Handle pong if needed
+	// A pong proves the path is alive for --idle-timeout
+	h.lastReceived.Store(time.Now().UnixNano())
 }
 
 func (h *WebSocketEventHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
 	// Record received bytes
+	now := time.Now()
 	h.lt.results.mu.Lock()
 	h.lt.results.BytesReceived += int64(message.Data.Len())
+	h.lt.results.MessagesReceived++
+	if h.lt.opts.SendOnConnectOnly && !h.lastMessage.IsZero() {
+		h.lt.results.InterArrivals = append(h.lt.results.InterArrivals, now.Sub(h.lastMessage))
+	}
 	h.lt.results.mu.Unlock()
+	h.lastMessage = now
+	h.lastReceived.Store(now.UnixNano())
+
+	if h.lt.opts.ReadTimeout > 0 {
+		socket.SetReadDeadline(time.Now().Add(h.lt.opts.ReadTimeout))
+	}
+
+	// The acknowledgement of --first-message is not paired with a data message
+	if h.awaitingFirst.CompareAndSwap(true, false) {
+		close(h.firstResponse)
+		if h.lt.verbose {
+			log.Printf("Connection %d first message acknowledged: %s", h.connID, message.Data.String())
+		}
+		return
+	}
+	h.received.Add(1)
+
+	var pairedSeq uint64
+	if h.inflight != nil {
+		sent, ok := h.inflight.pop()
+		if ok {
+			pairedSeq = sent.seq
+		} else {
+			h.lt.unpaired.Add(1)
+		}
+		if h.lt.opts.ValidateEcho {
+			h.verifyEcho(sent, ok, message.Data.Bytes())
+		}
+		// The response completes the round trip. With --response-timeout
+		// the request only succeeds now; late responses were already
+		// counted as failures.
+		if ok && !sent.expired {
+			roundTrip := now.Sub(sent.sentAt)
+			h.lt.results.mu.Lock()
+			if h.lt.opts.ResponseTimeout > 0 {
+				h.lt.recordSuccessLocked(roundTrip)
+			} else {
+				h.lt.recordLatencyLocked(roundTrip)
+			}
+			h.lt.recordMessageLatencyLocked(sent.seq, roundTrip)
+			h.lt.results.mu.Unlock()
+		}
+	}
+
+	h.lt.diagnostics.trace(h.connID, "receive", pairedSeq, message.Data.Len(), "")
 
 	if h.lt.verbose {
 		log.Printf("Connection %d received: %s", h.connID, message.Data.String())
 	}
 }
 
+// printServerPush reports the spacing of server-pushed messages for
+// --send-on-connect-only
+func (lt *LoadTest) printServerPush() {
+	fmt.Printf("Server Push:\n")
+	gaps := append([]time.Duration(nil), lt.results.InterArrivals...)
+	if len(gaps) == 0 {
+		fmt.Printf("  Fewer than two messages arrived on any connection\n")
+	} else {
+		unit := lt.opts.LatencyUnit
+		fmt.Printf("  Inter-arrival P50:  %s\n", formatLatency(calculatePercentile(gaps, 50), unit))
+		fmt.Printf("  Inter-arrival P95:  %s\n", formatLatency(calculatePercentile(gaps, 95), unit))
+		fmt.Printf("  Inter-arrival P99:  %s\n", formatLatency(calculatePercentile(gaps, 99), unit))
+		fmt.Printf("  Longest Gap:        %s\n", formatLatency(slices.Max(gaps), unit))
+	}
+	fmt.Printf("\n")
+}
+
+// verifyEcho compares a received payload byte-for-byte against the oldest
+// message that was awaiting its echo on this connection
+func (h *WebSocketEventHandler) verifyEcho(sent inflightMessage, ok bool, payload []byte) {
+	var problem string
+	switch {
+	case !ok:
+		problem = fmt.Sprintf("connection %d received %d bytes with no message awaiting an echo", h.connID, len(payload))
+	case sha256.Sum256(payload) != sent.digest:
+		problem = fmt.Sprintf("connection %d echo of message #%d does not match the sent payload", h.connID, sent.seq)
+	}
+
+	h.lt.results.mu.Lock()
+	defer h.lt.results.mu.Unlock()
+
+	if problem == "" {
+		h.lt.results.EchoesVerified++
+		return
+	}
+
+	h.lt.results.IntegrityErrors++
+	if h.lt.results.IntegrityExample == "" {
+		h.lt.results.IntegrityExample = problem
+	}
+	if h.lt.verbose {
+		log.Printf("Integrity failure: %s", problem)
+	}
+}
+
 // NewLoadTest creates a new load test instance
 func NewLoadTest(opts *TestOptions) *LoadTest {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Overrides and the message encoding are checked by validateTestOptions
+	resolve, _ := parseResolveOverrides(opts.Resolve)
+	message, _ := decodeMessage(opts)
+
 	return &LoadTest{
 		opts:    opts,
 		metrics: metrics.NewInmemSink(10*time.Second, 10*time.Minute),
 		results: &TestResults{
+			FuzzStats:       make(map[string]*fuzzStats),
 			ErrorCounts:     make(map[string]int),
 			StatusCodeCount: make(map[int]int),
-			Latencies:       make([]time.Duration, 0),
+			Histogram:       newHDRHistogram(),
+			WriteLatency:    newHDRHistogram(),
 			ErrorCategories: initializeErrorCategories(),
 		},
 		ctx:     ctx,
 		cancel:  cancel,
 		verbose: false,
+		resolve: resolve,
+		message: message,
+	}
+}
+
+// preparePayloads sets up the configured payload source: the message template,
+// size distribution, fuzz corpus or external generator. A started generator
+// must be stopped by the caller.
+func (lt *LoadTest) preparePayloads() error {
+	var err error
+
+	// Compile the message template once up front
+	if lt.opts.JSONTemplate != "" {
+		if lt.template, err = compileMessageTemplate(lt.opts.JSONTemplate); err != nil {
+			return err
+		}
+	}
+
+	// Prepare the payload size distribution
+	if lt.opts.SizeDist != "" {
+		if lt.sizeDist, err = parseSizeDistribution(lt.opts.SizeDist, lt.opts.Seed); err != nil {
+			return err
+		}
+	}
+
+	// Load the fuzz corpus
+	if lt.opts.Fuzz {
+		if lt.fuzz, err = loadFuzzCorpus(lt.opts.FuzzCorpus); err != nil {
+			return err
+		}
+	}
+
+	// Load the messages to cycle through
+	if lt.opts.MessagesFile != "" {
+		if lt.messages, err = loadMessagesFile(lt.opts.MessagesFile, lt.opts.MessageEncoding == "base64", lt.opts.StrictJSON); err != nil {
+			return err
+		}
+		lt.results.MessageLatencies = make([][]time.Duration, len(lt.messages))
 	}
+
+	// Start the external payload generator
+	if lt.opts.MessageCommand != "" {
+		if lt.command, err = startCommandGenerator(lt.opts.MessageCommand, lt.opts.MessageEncoding == "base64"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configError is a Run failure caused by the options rather than the target,
+// such as a payload source that cannot be read; main exits with
+// exitConfigError for it
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
 }
 
-// Run executes the load test
+// Run executes the load test. It only reports progress; use Results for the
+// metrics and printResults for the report.
 func (lt *LoadTest) Run() error {
 	// Parse duration
 	duration, err := time.ParseDuration(lt.opts.Duration)
 	if err != nil {
-		return fmt.Errorf("invalid duration format: %v", err)
-	}
-
-	// Set up progress bar
-	lt.progress = progressbar.NewOptions64(
-		int64(duration.Milliseconds()),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowBytes(false),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetDescription("[cyan][1/3][reset] Running WebSocket load test..."),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
+		return &configError{fmt.Errorf("invalid duration format: %v", err)}
+	}
+
+	if err := lt.preparePayloads(); err != nil {
+		return &configError{err}
+	}
+	if lt.command != nil {
+		defer lt.command.stop()
+	}
+
+	// Prepare the remote-write client
+	if lt.opts.RemoteWrite != "" {
+		if lt.remote, err = newRemoteWriter(lt.opts.RemoteWrite, lt.opts.RemoteWriteHeaders); err != nil {
+			return &configError{err}
+		}
+	}
+
+	// Stream raw latencies to disk; a bad path fails before any load starts
+	if lt.opts.CSVLatencies != "" {
+		if lt.results.LatencyStream, err = openLatencyStream(lt.opts.CSVLatencies); err != nil {
+			return &configError{err}
+		}
+	}
+
+	// Line up with other instances before anything is measured
+	if err := lt.waitForStart(time.Now()); err != nil {
+		if lt.results.LatencyStream != nil {
+			lt.results.LatencyStream.close()
+		}
+		return err
+	}
+
+	if lt.opts.MaxBandwidth > 0 {
+		lt.limiter = newTokenBucket(int64(lt.opts.MaxBandwidth))
+	}
 
 	// Record start time
 	lt.results.StartTime = time.Now()
+	lt.results.Resources.start()
+	lt.deadline = lt.results.StartTime.Add(duration)
+
+	// Draw the progress bar until Run returns
+	stopProgress := lt.startProgress(duration)
+	defer stopProgress()
+
+	if lt.verbose && lt.opts.RampDown > 0 {
+		log.Printf("Ramp-down: closing %d connections over the final %s (one every %s)",
+			lt.opts.Connections, lt.opts.RampDown, lt.opts.RampDown/time.Duration(lt.opts.Connections))
+	}
+
+	// Buffer frame traces in case a pass/fail check fails
+	if lt.opts.SaveOnBreach != "" {
+		lt.diagnostics = newDiagnostics(lt.results.StartTime)
+	}
+
+	// Ctrl-C stops the test but still reports what was measured
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go lt.watchInterrupt(interrupts)
+
+	// SIGUSR1 and SIGUSR2 pause and resume sending
+	lt.pause = newPauseGate(lt.results.StartTime)
+	go lt.watchPauseSignals()
+
+	// Closed loop: a new request starts only when one of the
+	// --target-concurrency requests in flight completes
+	if lt.opts.TargetConcurrency > 0 {
+		lt.slots = newConcurrencyLimiter(lt.opts.TargetConcurrency, lt.results.StartTime)
+	}
 
 	// Start metrics collection
 	go lt.collectMetrics()
+	if lt.remote != nil {
+		go lt.pushRemoteMetrics()
+	}
+
+	// Feed the shared --requests queue
+	var requestsFinished <-chan struct{}
+	if lt.opts.Requests > 0 {
+		lt.requests = newRequestQueue(lt.opts.Requests, int(lt.opts.Connections))
+		requestsFinished = lt.requests.finished
+		go lt.requests.feed(lt.ctx)
+	}
 
 	// Create connection pool
 	var wg sync.WaitGroup
 	connectionPool := make(chan struct{}, lt.opts.Connections)
 
-	// Start connections
-	for i := 0; i < lt.opts.Connections; i++ {
+	// Start connections, all at once or spread over --ramp-up. The control
+	// file only takes over once every connection has started.
+	controller := newConnectionController(lt, &wg, connectionPool)
+	if lt.opts.RampUp > 0 {
+		if lt.verbose {
+			log.Printf("Ramp-up: opening %d connections over %s (one every %s)",
+				lt.opts.Connections, lt.opts.RampUp, lt.opts.RampUp/time.Duration(lt.opts.Connections))
+		}
 		wg.Add(1)
-		go func(connID int) {
+		go func() {
 			defer wg.Done()
-			lt.runConnection(connID, connectionPool)
-		}(i)
+			controller.rampTo(int(lt.opts.Connections), lt.opts.RampUp)
+			if lt.ctx.Err() != nil {
+				return
+			}
+			lt.rampedUp.Store(true)
+			if lt.opts.ControlFile != "" {
+				controller.watch(lt.opts.ControlFile)
+			}
+		}()
+	} else {
+		controller.scaleTo(int(lt.opts.Connections))
+		if lt.opts.ControlFile != "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				controller.watch(lt.opts.ControlFile)
+			}()
+		}
 	}
 
-	// Wait for test duration
+	// Wait for test duration, or until every --requests message is sent
 	select {
 	case <-time.After(duration):
 		lt.cancel()
+	case <-requestsFinished:
+		lt.cancel()
 	case <-lt.ctx.Done():
 		// Test was cancelled
 	}
@@ -308,38 +874,149 @@ func (lt *LoadTest) Run() error {
 	// Wait for all connections to finish
 	wg.Wait()
 
-	// Record end time
+	// Record end time and close the timeline with the final totals
+	lt.results.mu.Lock()
 	lt.results.EndTime = time.Now()
+	lt.results.Resources.finish(lt.results.EndTime.Sub(lt.results.StartTime))
+	lt.results.Timeline = append(lt.results.Timeline, timelinePoint{
+		Successful: lt.results.SuccessfulReqs,
+		Failed:     lt.results.FailedReqs,
+	})
+	stream := lt.results.LatencyStream
+	lt.results.LatencyStream = nil
+	lt.results.mu.Unlock()
 
-	// Close progress bar
-	lt.progress.Finish()
+	if stream != nil {
+		if err := stream.close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	// Push whatever the periodic remote writes have not sent yet
+	if lt.remote != nil {
+		if err := lt.remote.flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	return nil
+}
 
-	// Print results
-	lt.printResults()
+// startTime returns when --start-at or --start-delay schedules the load to
+// begin, relative to now; it reports false when neither is set
+func (opts *TestOptions) startTime(now time.Time) (time.Time, bool, error) {
+	switch {
+	case opts.StartAt != "":
+		at, err := time.Parse(time.RFC3339, opts.StartAt)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid --start-at %q (use RFC3339, e.g. 2026-01-02T15:04:05Z): %v", opts.StartAt, err)
+		}
+		return at, true, nil
+	case opts.StartDelay > 0:
+		return now.Add(opts.StartDelay), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// waitForStart holds the test until its scheduled start, so load generators
+// launched with some jitter on different machines begin sending together.
+// A start time already passed begins at once, with a warning.
+func (lt *LoadTest) waitForStart(now time.Time) error {
+	at, ok, err := lt.opts.startTime(now)
+	if err != nil || !ok {
+		return err
+	}
+
+	wait := at.Sub(now)
+	if wait <= 0 {
+		fmt.Fprintf(os.Stderr, "Warning: start time %s passed %s ago; starting now\n", at.Format(time.RFC3339Nano), (-wait).Round(time.Millisecond))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Waiting %s for the synchronized start at %s\n", wait.Round(time.Millisecond), at.Format(time.RFC3339Nano))
 
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-lt.ctx.Done():
+		return fmt.Errorf("cancelled while waiting for the start time")
+	}
+	fmt.Fprintf(os.Stderr, "Starting load at %s\n", time.Now().Format(time.RFC3339Nano))
 	return nil
 }
 
-// runConnection handles a single WebSocket connection
-func (lt *LoadTest) runConnection(connID int, pool chan struct{}) {
+// runConnection handles a single WebSocket connection until ctx is done. It
+// reports whether the connection was closed because its --connection-lifetime
+// expired, in which case the caller replaces it.
+func (lt *LoadTest) runConnection(ctx context.Context, connID int, pool chan struct{}) bool {
 	// Acquire connection slot
-	pool <- struct{}{}
-	defer func() { <-pool }()
+	if pool != nil {
+		pool <- struct{}{}
+		defer func() { <-pool }()
+	}
+
+	// Ramp-down and --connection-lifetime close this connection on its own
+	// schedule, whichever comes first
+	done := ctx.Done()
+	earlyReason := ""
+	var deadline time.Time
+	if lt.opts.RampDown > 0 {
+		deadline, earlyReason = lt.connectionDeadline(connID), "ramp down"
+	}
+	if lt.opts.ConnectionLifetime > 0 {
+		if expiry := time.Now().Add(lt.opts.ConnectionLifetime); earlyReason == "" || expiry.Before(deadline) {
+			deadline, earlyReason = expiry, "lifetime expired"
+		}
+	}
+	if earlyReason != "" {
+		connCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		done = connCtx.Done()
+	}
 
 	// Create WebSocket client handler
 	handler := &WebSocketEventHandler{
 		connID: connID,
 		lt:     lt,
 	}
+	if lt.tracksResponses() {
+		handler.inflight = newInflightTracker()
+		handler.inflight.slots = lt.slots
+	}
+	if lt.opts.FirstMessage != "" && lt.opts.AwaitFirstResponse {
+		handler.firstResponse = make(chan struct{})
+		handler.awaitingFirst.Store(true)
+	}
+	if lt.opts.ReconnectOn != "never" {
+		handler.serverClosed = make(chan struct{})
+	}
 
 	// Create WebSocket client
-	client, _, err := gws.NewClient(handler, &gws.ClientOption{
-		Addr:             lt.opts.URL,
-		HandshakeTimeout: 10 * time.Second,
-	})
+	client, _, err := lt.dial(handler)
 	if err != nil {
 		lt.recordError(fmt.Sprintf("client_creation_failed_%d", connID), err)
-		return
+		// Connect timeouts only count when --handshake-timeout bounds them too
+		var connectErr *connectError
+		separateConnect := errors.As(err, &connectErr) && lt.opts.TCPConnectTimeout > 0
+		if categorizeError(err) == ErrorCategoryTimeout && !separateConnect && !lt.isCancellation(err) {
+			lt.results.mu.Lock()
+			lt.results.HandshakeTimeouts++
+			lt.results.mu.Unlock()
+		}
+		var redirect *redirectError
+		if errors.As(err, &redirect) {
+			lt.results.mu.Lock()
+			lt.results.RedirectLocation = redirect.location
+			lt.results.mu.Unlock()
+		}
+		lt.noteConnectResult(false)
+		return false
+	}
+	lt.noteConnectResult(true)
+
+	// Arm the read deadline before the read loop starts
+	if lt.opts.ReadTimeout > 0 {
+		client.SetReadDeadline(time.Now().Add(lt.opts.ReadTimeout))
 	}
 
 	// Start reading messages in a separate goroutine
@@ -354,96 +1031,878 @@ func (lt *LoadTest) runConnection(connID int, pool chan struct{}) {
 		client.ReadLoop()
 	}()
 
-	// Send messages in loop
-	for i := 0; i < lt.opts.Loop; i++ {
+	// Some protocols require a hello/auth frame before any data
+	if lt.opts.FirstMessage != "" {
+		if err := lt.sendFirstMessage(client, handler, lt.handshakeTimeout()); err != nil {
+			lt.recordCategorizedError(fmt.Sprintf("first_message_failed_%d", connID), ErrorCategoryAuthFailure, err)
+			client.WriteClose(1000, []byte("first message failed"))
+			return false
+		}
+	}
+
+	opened := time.Now()
+	lt.results.mu.Lock()
+	lt.results.EstablishedConns++
+	lt.results.mu.Unlock()
+	defer func() {
+		lt.results.mu.Lock()
+		lt.results.ConnLifetimes = append(lt.results.ConnLifetimes, time.Since(opened))
+		lt.results.ConnRequests = append(lt.results.ConnRequests, handler.sent.Load())
+		lt.results.ConnectedTime += time.Since(opened)
+		lt.results.mu.Unlock()
+		if lt.opts.ExpectReceived > 0 {
+			lt.checkReceived(connID, handler.received.Load())
+		}
+		lt.diagnostics.closed(connID, opened, handler.sent.Load(), handler.received.Load())
+		// Responses can no longer arrive, so free their concurrency slots
+		if handler.inflight != nil {
+			handler.inflight.abandon()
+		}
+	}()
+
+	if lt.opts.ResponseTimeout > 0 {
+		go lt.watchResponseTimeouts(handler, done)
+	}
+	if lt.opts.IdleTimeout > 0 {
+		handler.lastReceived.Store(time.Now().UnixNano())
+		handler.dead = make(chan struct{})
+		go lt.watchIdle(client, handler, done)
+	}
+
+	// Route sends through a bounded queue when requested
+	send := func(msgID int) { lt.sendMessage(client, handler, msgID) }
+	if lt.opts.SendQueueSize > 0 {
+		enqueue, stop := lt.startSendQueue(client, handler)
+		defer stop()
+		send = enqueue
+	}
+
+	// Send messages in loop; in pub/sub mode a single subscribe message, with
+	// --requests whatever the shared queue hands this connection, and with
+	// --loop 0 (--continuous) messages until the test ends
+	loops := lt.opts.Loop
+	if lt.opts.SendOnConnectOnly {
+		loops = 1
+	}
+	next := func(i int) (int, bool) { return i, i < loops }
+	switch {
+	case lt.requests != nil:
+		next = func(int) (int, bool) { return lt.requests.take(done) }
+	case loops == 0:
+		next = func(i int) (int, bool) { return i, true }
+	}
+
+	// --rate spaces the sends out on a fixed schedule, however fast each
+	// write returns
+	var pace <-chan time.Time
+	if lt.opts.Rate > 0 {
+		ticker := time.NewTicker(rateInterval(lt.opts.Rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	for i := 0; ; i++ {
+		if pace != nil && i > 0 {
+			select {
+			case <-pace:
+			case <-done:
+			case <-handler.dead:
+			case <-handler.serverClosed:
+			}
+		}
+		msgID, ok := next(i)
+		if !ok {
+			break
+		}
+		lt.pause.wait(done)
 		select {
-		case <-lt.ctx.Done():
-			client.WriteClose(1000, []byte("test cancelled"))
-			return
+		case <-done:
+			handler.closing.Store(true)
+			reason := lt.closeReason(ctx, "test cancelled", earlyReason)
+			lt.drain(handler)
+			client.WriteClose(1000, []byte(reason))
+			// Lifetime expiry, scale-down and ramp-down leave the test running,
+			// so another connection sends the request instead
+			lt.returnUnsent(msgID, lt.ctx.Err() == nil)
+			return reason == "lifetime expired"
+		case <-handler.dead:
+			lt.returnUnsent(msgID, false)
+			return false
+		case <-handler.serverClosed:
+			reconnect := lt.reconnectAfter(ctx, connID, handler.closeErr)
+			lt.returnUnsent(msgID, reconnect)
+			return reconnect
 		default:
-			lt.sendMessage(client, connID, i)
+			send(msgID)
+			if lt.requests != nil {
+				lt.requests.done()
+			}
 		}
 	}
 
 	// Keep connection open until test duration expires
 	select {
-	case <-lt.ctx.Done():
-		// Test duration expired, close gracefully
-		client.WriteClose(1000, []byte("test completed"))
+	case <-done:
+	case <-handler.dead:
+		return false
+	case <-handler.serverClosed:
+		return lt.reconnectAfter(ctx, connID, handler.closeErr)
 	}
-}
+	handler.closing.Store(true)
 
-// sendMessage sends a single message and records metrics
-func (lt *LoadTest) sendMessage(client *gws.Conn, connID, msgID int) {
-	startTime := time.Now()
+	// Collect in-flight responses and close gracefully
+	reason := lt.closeReason(ctx, "test completed", earlyReason)
+	if lt.verbose && reason != "test completed" {
+		log.Printf("Connection %d closing: %s", connID, reason)
+	}
+	lt.drain(handler)
+	client.WriteClose(1000, []byte(reason))
+	return reason == "lifetime expired"
+}
 
-	// Send message
-	err := client.WriteMessage(gws.OpcodeText, []byte(lt.opts.Message))
-	if err != nil {
-		lt.recordError(fmt.Sprintf("send_failed_%d_%d", connID, msgID), err)
+// returnUnsent settles a --requests message that a closing connection took
+// but did not send: it goes back to the queue when requeue is set, for a
+// connection that closed on purpose or is being replaced, and is given up
+// otherwise, so the shared queue still finishes.
+func (lt *LoadTest) returnUnsent(msgID int, requeue bool) {
+	if lt.requests == nil {
 		return
 	}
+	if requeue {
+		lt.requests.putBack(msgID)
+	} else {
+		lt.requests.done()
+	}
+}
 
-	// Record metrics
-	latency := time.Since(startTime)
-	lt.results.mu.Lock()
-	lt.results.TotalRequests++
-	lt.results.SuccessfulReqs++
-	lt.results.TotalLatency += latency
-	lt.results.Latencies = append(lt.results.Latencies, latency)
-	// Update peak response time if this latency is higher
-	if latency > lt.results.PeakResponseTime {
-		lt.results.PeakResponseTime = latency
+// loopCount describes --loop, where 0 means sending until the test ends
+func loopCount(loop int) string {
+	if loop == 0 {
+		return "continuous (until the duration ends)"
 	}
-	lt.results.BytesSent += int64(len(lt.opts.Message))
-	lt.results.mu.Unlock()
+	return strconv.Itoa(loop)
+}
 
-	// Update progress bar
-	lt.progress.Add(1)
+// rateInterval is the time between two sends on a connection at --rate
+// messages per second
+func rateInterval(rate float64) time.Duration {
+	return max(time.Duration(float64(time.Second)/rate), time.Nanosecond)
 }
 
-// recordError records an error occurrence
-func (lt *LoadTest) recordError(errorType string, err error) {
+// checkReceived fails a connection that closed without receiving the
+// --expect-received number of messages. Unlike other errors this is judged
+// as the test ends, so it is never counted as a cancellation.
+func (lt *LoadTest) checkReceived(connID int, received int64) {
+	expected := int64(lt.opts.ExpectReceived)
+	if received == expected || (received > expected && !lt.opts.ExactReceived) {
+		return
+	}
+
+	qualifier := "at least"
+	if lt.opts.ExactReceived {
+		qualifier = "exactly"
+	}
+	err := fmt.Errorf("connection %d received %d messages, expected %s %d", connID, received, qualifier, expected)
+
 	lt.results.mu.Lock()
 	defer lt.results.mu.Unlock()
-
+	lt.results.ShortConnections++
 	lt.results.TotalRequests++
 	lt.results.FailedReqs++
-	lt.results.ErrorCounts[errorType]++
-
-	// Categorize the error
-	category := categorizeError(err)
-	if categoryInfo, exists := lt.results.ErrorCategories[category]; exists {
-		categoryInfo.Count++
-		// Add example if we don't have too many already (limit to 3 examples per category)
-		if len(categoryInfo.Examples) < 3 {
-			categoryInfo.Examples = append(categoryInfo.Examples, err.Error())
-		}
-	}
-
+	lt.results.ErrorCounts[fmt.Sprintf("received_count_%d", connID)]++
+	lt.results.ErrorCategories[ErrorCategoryFanOut].record(1, err.Error(), time.Since(lt.results.StartTime))
 	if lt.verbose {
-		log.Printf("Error (%s) [%s]: %v", errorType, category, err)
+		log.Printf("Error (received_count_%d) [%s]: %v", connID, ErrorCategoryFanOut, err)
 	}
 }
 
-// collectMetrics periodically collects and reports metrics
-func (lt *LoadTest) collectMetrics() {
+// reconnectDelay is the pause before reconnecting after a server close, so a
+// server that closes every connection at once is not hit by a tight loop
+const reconnectDelay = 100 * time.Millisecond
+
+// isGracefulClose reports whether the server closed the connection on purpose:
+// a close frame with 1000 (normal closure) or 1001 (going away). Anything else,
+// including a connection dropped without a close frame (1006), is abnormal.
+func isGracefulClose(err error) bool {
+	var closeErr *gws.CloseError
+	return errors.As(err, &closeErr) && (closeErr.Code == 1000 || closeErr.Code == 1001)
+}
+
+// reconnectAfter applies --reconnect-on to a connection the server closed and
+// reports whether it should be replaced
+func (lt *LoadTest) reconnectAfter(ctx context.Context, connID int, err error) bool {
+	graceful := isGracefulClose(err)
+	reconnect := lt.opts.ReconnectOn == "all" || (lt.opts.ReconnectOn == "abnormal" && !graceful)
+
+	lt.results.mu.Lock()
+	lt.results.ServerCloses++
+	if reconnect {
+		lt.results.Reconnects++
+	}
+	lt.results.mu.Unlock()
+
+	if lt.verbose {
+		action := "not reconnecting"
+		if reconnect {
+			action = "reconnecting"
+		}
+		log.Printf("Connection %d closed by server (%v); %s", connID, err, action)
+	}
+	if !reconnect {
+		return false
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(reconnectDelay):
+		return true
+	}
+}
+
+// noteConnectResult tracks consecutive handshake failures while the initial
+// connections open and aborts the test once --max-connect-failures is reached,
+// so a refusing server is not hit by the rest of the connect storm
+func (lt *LoadTest) noteConnectResult(ok bool) {
+	attempt := lt.dialAttempts.Add(1)
+	if ok {
+		lt.connectFailures.Store(0)
+		return
+	}
+
+	failures := lt.connectFailures.Add(1)
+	if lt.opts.MaxConnectFailures > 0 && attempt <= int64(lt.opts.Connections) && failures >= int64(lt.opts.MaxConnectFailures) {
+		lt.abort(fmt.Sprintf("connection phase aborted — server refusing connections (%d consecutive handshake failures)", failures))
+	}
+}
+
+// abort stops the test early; the first reason wins
+func (lt *LoadTest) abort(reason string) {
+	lt.abortOnce.Do(func() {
+		lt.abortReason = reason
+		fmt.Fprintf(os.Stderr, "\nAborting: %s\n", reason)
+		lt.cancel()
+	})
+}
+
+// watchInterrupt ends the test early on the first Ctrl-C (SIGINT) or
+// SIGTERM delivered to signals, so the connections drain and the results
+// collected so far are still reported. The handler is removed once a signal
+// arrives, so a second one quits at once.
+func (lt *LoadTest) watchInterrupt(signals chan os.Signal) {
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		reason := "interrupted (Ctrl-C)"
+		if sig == syscall.SIGTERM {
+			reason = "terminated (SIGTERM)"
+		}
+		lt.abort(reason)
+		fmt.Fprintf(os.Stderr, "Reporting partial results; interrupt again to quit at once\n")
+	case <-lt.ctx.Done():
+	}
+}
+
+// connectionDeadline returns when a connection should close during
+// --ramp-down; closes are staggered evenly so the last connection closes as
+// the test ends
+func (lt *LoadTest) connectionDeadline(connID int) time.Time {
+	step := lt.opts.RampDown * time.Duration(connID+1) / time.Duration(lt.opts.Connections)
+	return lt.deadline.Add(step - lt.opts.RampDown)
+}
+
+// closeReason returns the close frame reason, distinguishing connections
+// closed early by scaling down, ramp-down or lifetime expiry from those closed
+// at the end of the test
+func (lt *LoadTest) closeReason(ctx context.Context, reason, earlyReason string) string {
+	switch {
+	case lt.ctx.Err() != nil:
+		return reason
+	case ctx.Err() != nil:
+		return "scaled down"
+	case earlyReason != "":
+		return earlyReason
+	}
+	return reason
+}
+
+// progressWriter returns where the progress bar is drawn; stderr keeps it out
+// of stdout when results are piped, and is implied by a non-text --output.
+// --output json hides it, as the output is meant for tools rather than people.
+func (lt *LoadTest) progressWriter() io.Writer {
+	if lt.opts.Output == "json" {
+		return io.Discard
+	}
+	if lt.opts.ProgressToStderr || (lt.opts.Output != "" && lt.opts.Output != "text") {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// handshakeTimeout returns the configured handshake timeout, falling back to
+// the default when unset
+func (lt *LoadTest) handshakeTimeout() time.Duration {
+	if lt.opts.HandshakeTimeout <= 0 {
+		return defaultHandshakeTimeout
+	}
+	return lt.opts.HandshakeTimeout
+}
+
+// dial opens a WebSocket connection to the target with the configured
+// handshake options. The handshake response, when one arrived, carries the
+// request that was sent.
+func (lt *LoadTest) dial(handler gws.Event) (*gws.Conn, *http.Response, error) {
+	handshakeTimeout := lt.handshakeTimeout()
+
+	requestHeader := http.Header{}
+	if len(lt.opts.Subprotocols) > 0 {
+		requestHeader.Set("Sec-WebSocket-Protocol", strings.Join(lt.opts.Subprotocols, ", "))
+	}
+
+	connectTimeout := handshakeTimeout
+	if lt.opts.TCPConnectTimeout > 0 {
+		connectTimeout = lt.opts.TCPConnectTimeout
+	}
+
+	dialer := lt.newSocketDialer(connectTimeout)
+	client, resp, err := gws.NewClient(handler, &gws.ClientOption{
+		Addr:             lt.opts.URL,
+		HandshakeTimeout: handshakeTimeout,
+		RequestHeader:    requestHeader,
+		NewDialer:        func() (gws.Dialer, error) { return dialer, nil },
+	})
+	if err != nil {
+		if errors.Is(err, gws.ErrSubprotocolNegotiation) && resp != nil {
+			err = fmt.Errorf("%w: requested %q, server selected %q", err,
+				strings.Join(lt.opts.Subprotocols, ", "), resp.Header.Get("Sec-WebSocket-Protocol"))
+		}
+		if errors.Is(err, gws.ErrHandshake) && resp != nil {
+			switch {
+			case resp.StatusCode/100 == 3:
+				err = newRedirectError(resp)
+			case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+				err = fmt.Errorf("%w: %w, server answered %s", err, gws.ErrUnauthorized, resp.Status)
+			}
+		}
+		// Name the phase that timed out; connect failures already carry it
+		var connectErr *connectError
+		if !errors.As(err, &connectErr) && categorizeError(err) == ErrorCategoryTimeout {
+			err = fmt.Errorf("websocket upgrade timed out after %s: %w", handshakeTimeout, err)
+		}
+		return nil, resp, err
+	}
+
+	// Keep the headers of the first successful handshake for auditing
+	if lt.opts.CaptureHeaders && resp != nil {
+		lt.captureHeadersOnce.Do(func() {
+			lt.results.mu.Lock()
+			lt.results.HandshakeHeaders = resp.Header.Clone()
+			lt.results.mu.Unlock()
+		})
+	}
+	return client, resp, nil
+}
+
+// sendFirstMessage sends the --first-message payload once per connection and,
+// with --await-first-response, blocks until the server acknowledges it
+func (lt *LoadTest) sendFirstMessage(client *gws.Conn, h *WebSocketEventHandler, timeout time.Duration) error {
+	payload := []byte(lt.opts.FirstMessage)
+
+	// Without an acknowledgement to consume, an echo of the first message must
+	// stay paired with its send
+	if h.inflight != nil && h.firstResponse == nil {
+		if !lt.slots.acquire(lt.ctx.Done()) {
+			return lt.ctx.Err()
+		}
+		lt.trackSend(h, atomic.AddUint64(&lt.seq, 1), payload)
+	}
+
+	if err := client.WriteMessage(lt.opcode(), payload); err != nil {
+		return fmt.Errorf("failed to send first message: %w", err)
+	}
+
+	lt.results.mu.Lock()
+	lt.results.BytesSent += int64(len(payload))
+	lt.results.mu.Unlock()
+
+	if h.firstResponse == nil {
+		return nil
+	}
+
+	select {
+	case <-h.firstResponse:
+		return nil
+	case <-lt.ctx.Done():
+		return lt.ctx.Err()
+	case <-time.After(timeout):
+		return fmt.Errorf("no response to first message within %s", timeout)
+	}
+}
+
+// opcode returns the frame type used for every message sent in the test
+func (lt *LoadTest) opcode() gws.Opcode {
+	if binaryFrames(lt.opts) {
+		return gws.OpcodeBinary
+	}
+	return gws.OpcodeText
+}
+
+// tracksResponses reports whether sent messages are paired with responses.
+// They are whenever the traffic is request/response, so latency is measured
+// as the round trip; server pushes and fuzz cases answer no particular send.
+func (lt *LoadTest) tracksResponses() bool {
+	if lt.opts.ValidateEcho || lt.opts.DrainTimeout > 0 || lt.opts.ResponseTimeout > 0 || lt.opts.IdleTimeout > 0 {
+		return true
+	}
+	return !lt.opts.SendOnConnectOnly && !lt.opts.Fuzz
+}
+
+// trackSend registers a message with the connection's in-flight tracker. A
+// message pushed out of a full tracker never had its response paired, so it
+// counts as unpaired traffic, and with --response-timeout as a timeout
+// failure, which it would have become anyway.
+func (lt *LoadTest) trackSend(h *WebSocketEventHandler, seq uint64, payload []byte) {
+	dropped, overflowed := h.inflight.push(seq, lt.echoPayload(payload))
+	if !overflowed {
+		return
+	}
+	lt.unpaired.Add(1)
+	if lt.opts.ResponseTimeout > 0 && !dropped.expired {
+		lt.recordCategorizedError(fmt.Sprintf("response_timeout_%d", h.connID), ErrorCategoryTimeout,
+			fmt.Errorf("no response before %d later messages were sent", maxPending))
+	}
+}
+
+// echoPayload returns what the in-flight tracker keeps of a sent payload:
+// the payload itself when --validate-echo compares echoes against it, and
+// nothing otherwise, so plain round trips skip hashing every message
+func (lt *LoadTest) echoPayload(payload []byte) []byte {
+	if lt.opts.ValidateEcho {
+		return payload
+	}
+	return nil
+}
+
+// avgWriteLatency returns the mean time a send took to write
+func (r *TestResults) avgWriteLatency() time.Duration {
+	if r.Writes == 0 {
+		return 0
+	}
+	return r.TotalWriteLatency / time.Duration(r.Writes)
+}
+
+// avgLatency returns the mean round-trip latency of the requests whose
+// response arrived
+func (r *TestResults) avgLatency() time.Duration {
+	if r.RoundTrips == 0 {
+		return 0
+	}
+	return r.TotalLatency / time.Duration(r.RoundTrips)
+}
+
+// drain keeps a connection open after the test ends so responses to messages
+// already in flight can still arrive. Messages left unanswered when the drain
+// timeout expires are re-counted as timeout failures.
+func (lt *LoadTest) drain(h *WebSocketEventHandler) {
+	if h.inflight == nil {
+		return
+	}
+	if lt.opts.DrainTimeout <= 0 {
+		// Without a drain, responses still pending with --response-timeout
+		// are cut off by the end of the test rather than failed
+		if lt.opts.ResponseTimeout > 0 {
+			lt.results.mu.Lock()
+			lt.results.CancelledReqs += int64(h.inflight.count())
+			lt.results.mu.Unlock()
+		}
+		return
+	}
+
+	deadline := time.Now().Add(lt.opts.DrainTimeout)
+	for h.inflight.count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	unanswered := h.inflight.count()
+	if unanswered == 0 {
+		return
+	}
+
+	err := fmt.Errorf("no response within drain timeout of %s", lt.opts.DrainTimeout)
+
+	lt.results.mu.Lock()
+	defer lt.results.mu.Unlock()
+
+	// Unanswered messages were counted as successes when sent, except with
+	// --response-timeout, where they have not been counted yet
+	if lt.opts.ResponseTimeout > 0 {
+		lt.results.TotalRequests += int64(unanswered)
+	} else {
+		lt.results.SuccessfulReqs -= int64(unanswered)
+	}
+	lt.results.FailedReqs += int64(unanswered)
+	lt.results.ErrorCounts[fmt.Sprintf("drain_timeout_%d", h.connID)] += unanswered
+	lt.results.ErrorCategories[ErrorCategoryTimeout].record(unanswered, err.Error(), time.Since(lt.results.StartTime))
+
+	if lt.verbose {
+		log.Printf("Connection %d: %d messages unanswered after drain", h.connID, unanswered)
+	}
+}
+
+// startSendQueue starts a writer goroutine that drains a bounded per-connection
+// queue. The returned enqueue function never blocks: when the queue is full the
+// message is dropped and counted instead of stalling the send loop.
+func (lt *LoadTest) startSendQueue(client *gws.Conn, h *WebSocketEventHandler) (enqueue func(int), stop func()) {
+	queue := make(chan int, lt.opts.SendQueueSize)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case msgID, ok := <-queue:
+				if !ok {
+					return
+				}
+				lt.sendMessage(client, h, msgID)
+			case <-lt.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	enqueue = func(msgID int) {
+		select {
+		case queue <- msgID:
+		default:
+			lt.results.mu.Lock()
+			lt.results.DroppedMessages++
+			lt.results.mu.Unlock()
+			if lt.verbose {
+				log.Printf("Connection %d send queue full, dropped message %d", h.connID, msgID)
+			}
+		}
+	}
+
+	stop = func() {
+		close(queue)
+		<-done
+	}
+
+	return enqueue, stop
+}
+
+// buildPayload returns the bytes to send for one message, rendering the JSON
+// template or drawing a sized payload when configured
+func (lt *LoadTest) buildPayload(connID, msgID int, seq uint64) ([]byte, error) {
+	if lt.sizeDist != nil {
+		return lt.sizeDist.payload(), nil
+	}
+	if lt.messages != nil {
+		return lt.messages[lt.messageIndex(seq)].payload, nil
+	}
+	if lt.command == nil && lt.template == nil {
+		return lt.message, nil
+	}
+
+	var payload []byte
+	var err error
+	if lt.command != nil {
+		payload, err = lt.command.next(lt.opts.CommandTimeout)
+	} else {
+		payload, err = renderMessageTemplate(lt.template, messageTemplateData{
+			ConnID: connID,
+			MsgID:  msgID,
+			Seq:    seq,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Generated payloads are only checked once rendered
+	if lt.opts.StrictJSON && !isValidJSON(string(payload)) {
+		return nil, fmt.Errorf("generated message is not valid JSON (--strict-json): %s", sanitizeMessage(string(payload), 100))
+	}
+	return payload, nil
+}
+
+// sendMessage sends a single message and records metrics
+func (lt *LoadTest) sendMessage(client *gws.Conn, h *WebSocketEventHandler, msgID int) {
+	seq := atomic.AddUint64(&lt.seq, 1)
+	payload, err := lt.buildPayload(h.connID, msgID, seq)
+	if err != nil {
+		if lt.command != nil {
+			lt.recordCategorizedError(fmt.Sprintf("message_command_failed_%d_%d", h.connID, msgID), ErrorCategoryGenerator, err)
+		} else {
+			lt.recordError(fmt.Sprintf("template_failed_%d_%d", h.connID, msgID), err)
+		}
+		return
+	}
+
+	// --fuzz rotates through the corpus instead of sending the message
+	var fuzz *fuzzCase
+	if lt.fuzz != nil {
+		fuzz = &lt.fuzz[(seq-1)%uint64(len(lt.fuzz))]
+		payload = fuzz.payload
+		h.lastFuzzCase.Store(fuzz.name)
+	}
+
+	// Pace sends to --max-bandwidth; throttling is not counted as latency
+	if lt.limiter != nil {
+		if err := lt.limiter.wait(lt.ctx, len(payload)); err != nil {
+			return
+		}
+	}
+
+	// Wait for one of the --target-concurrency requests to complete
+	if !lt.slots.acquire(lt.ctx.Done()) {
+		return
+	}
+
+	// Register the message before writing so a fast echo cannot overtake it
+	if h.inflight != nil {
+		lt.trackSend(h, seq, payload)
+	}
+
+	startTime := time.Now()
+
+	// Bound how long the write may block on a full socket buffer
+	if lt.opts.WriteTimeout > 0 {
+		client.SetWriteDeadline(startTime.Add(lt.opts.WriteTimeout))
+		defer client.SetWriteDeadline(time.Time{})
+	}
+
+	// Send message
+	if fuzz != nil {
+		err = writeFuzzCase(client, *fuzz)
+		if !h.closing.Load() && !errors.Is(err, gws.ErrConnClosed) {
+			lt.recordFuzzResult(fuzz.name, err, nil)
+		}
+	} else if lt.opts.FrameSize > 0 && len(payload) > lt.opts.FrameSize {
+		err = writeFragmented(client.NetConn(), lt.opcode(), payload, lt.opts.FrameSize)
+		if err == nil {
+			lt.results.mu.Lock()
+			lt.results.FragmentedMsgs++
+			lt.results.FragmentFrames += int64(fragmentFrames(len(payload), lt.opts.FrameSize))
+			lt.results.mu.Unlock()
+		}
+	} else {
+		err = client.WriteMessage(lt.opcode(), payload)
+	}
+	if err != nil {
+		if h.inflight != nil {
+			h.inflight.discard(seq)
+		}
+		lt.recordError(fmt.Sprintf("send_failed_%d_%d", h.connID, msgID), err)
+		return
+	}
+
+	// Record metrics; the latency is the round trip, recorded when the
+	// response arrives, and with --response-timeout so is the success
+	latency := time.Since(startTime)
+	lt.results.mu.Lock()
+	lt.recordWriteLocked(latency)
+	if lt.opts.ResponseTimeout == 0 {
+		lt.results.TotalRequests++
+		lt.results.SuccessfulReqs++
+	}
+	lt.results.BytesSent += int64(len(payload))
+	lt.results.mu.Unlock()
+	h.sent.Add(1)
+	lt.diagnostics.trace(h.connID, "send", seq, len(payload), "")
+}
+
+// latencyPercentiles returns the given percentiles of the successful request
+// latencies from the histogram, which holds every round trip in fixed memory;
+// results.mu must be held
+func (lt *LoadTest) latencyPercentiles(percentiles []float64) []time.Duration {
+	values := make([]time.Duration, len(percentiles))
+	for i, p := range percentiles {
+		values[i] = lt.results.Histogram.valueAtPercentile(p)
+	}
+	return values
+}
+
+// recordSuccessLocked records a successful request and its round-trip
+// latency; results.mu must be held
+func (lt *LoadTest) recordSuccessLocked(latency time.Duration) {
+	lt.results.TotalRequests++
+	lt.results.SuccessfulReqs++
+	lt.recordLatencyLocked(latency)
+}
+
+// recordWriteLocked records how long a send took to write; results.mu must
+// be held
+func (lt *LoadTest) recordWriteLocked(latency time.Duration) {
+	lt.results.Writes++
+	lt.results.TotalWriteLatency += latency
+	lt.results.WriteLatency.record(latency)
+}
+
+// recordLatencyLocked records the round-trip latency of a request whose
+// response arrived; results.mu must be held
+func (lt *LoadTest) recordLatencyLocked(latency time.Duration) {
+	lt.results.RoundTrips++
+	lt.results.TotalLatency += latency
+	lt.results.Histogram.record(latency)
+	if lt.results.LatencyStream != nil {
+		lt.results.LatencyStream.record(time.Now(), latency)
+	}
+	lt.diagnostics.latency(latency)
+	// Update peak response time if this latency is higher
+	if latency > lt.results.PeakResponseTime {
+		lt.results.PeakResponseTime = latency
+	}
+}
+
+// watchResponseTimeouts counts messages whose response has not arrived within
+// --response-timeout as timeout failures, until done is closed
+func (lt *LoadTest) watchResponseTimeouts(h *WebSocketEventHandler, done <-chan struct{}) {
+	interval := min(max(lt.opts.ResponseTimeout/10, time.Millisecond), 100*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	err := fmt.Errorf("no response within %s", lt.opts.ResponseTimeout)
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			for n := h.inflight.expire(now.Add(-lt.opts.ResponseTimeout)); n > 0; n-- {
+				lt.recordCategorizedError(fmt.Sprintf("response_timeout_%d", h.connID), ErrorCategoryTimeout, err)
+			}
+		}
+	}
+}
+
+// watchIdle closes a connection that has received nothing for --idle-timeout
+// while responses are outstanding. A half-open connection (the path silently
+// dropped, no FIN or RST) keeps accepting writes into the local buffer, so the
+// messages still awaiting a response are re-counted as network failures.
+func (lt *LoadTest) watchIdle(client *gws.Conn, h *WebSocketEventHandler, done <-chan struct{}) {
+	interval := min(max(lt.opts.IdleTimeout/10, time.Millisecond), time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			// Silence only counts from when a response was first expected
+			sentAt, waiting := h.inflight.oldest()
+			if !waiting {
+				continue
+			}
+			silentSince := time.Unix(0, h.lastReceived.Load())
+			if sentAt.After(silentSince) {
+				silentSince = sentAt
+			}
+			if now.Sub(silentSince) < lt.opts.IdleTimeout {
+				continue
+			}
+
+			h.closing.Store(true)
+			close(h.dead)
+			client.NetConn().Close()
+			lt.recordHalfOpen(h, now.Sub(silentSince))
+			return
+		}
+	}
+}
+
+// recordHalfOpen counts the messages left unanswered on a connection closed by
+// --idle-timeout as network failures
+func (lt *LoadTest) recordHalfOpen(h *WebSocketEventHandler, silence time.Duration) {
+	unanswered := h.inflight.abandon()
+	err := fmt.Errorf("connection half-open: nothing received for %s with %d responses outstanding", silence.Round(time.Millisecond), unanswered)
+
+	lt.results.mu.Lock()
+	defer lt.results.mu.Unlock()
+
+	// Unanswered messages were counted as successes when sent, except with
+	// --response-timeout, where they have not been counted yet
+	if lt.opts.ResponseTimeout > 0 {
+		lt.results.TotalRequests += int64(unanswered)
+	} else {
+		lt.results.SuccessfulReqs -= int64(unanswered)
+	}
+	lt.results.FailedReqs += int64(unanswered)
+	lt.results.ErrorCounts[fmt.Sprintf("half_open_%d", h.connID)] += unanswered
+	lt.results.ErrorCategories[ErrorCategoryNetworkError].record(unanswered, err.Error(), time.Since(lt.results.StartTime))
+
+	if lt.verbose {
+		log.Printf("Connection %d closed: %v", h.connID, err)
+	}
+}
+
+// isCancellation reports whether an error was caused by the test ending,
+// e.g. a write racing the connection close, rather than by the server
+func (lt *LoadTest) isCancellation(err error) bool {
+	return lt.ctx.Err() != nil || errors.Is(err, context.Canceled)
+}
+
+// recordError records an error occurrence
+func (lt *LoadTest) recordError(errorType string, err error) {
+	lt.recordCategorizedError(errorType, categorizeError(err), err)
+}
+
+// recordCategorizedError records an error occurrence under a known category
+func (lt *LoadTest) recordCategorizedError(errorType, category string, err error) {
+	lt.results.mu.Lock()
+	defer lt.results.mu.Unlock()
+
+	// Errors caused by the test shutting down are not failures
+	if lt.isCancellation(err) {
+		lt.results.CancelledReqs++
+		if lt.verbose {
+			log.Printf("Ignoring error after cancellation (%s): %v", errorType, err)
+		}
+		return
+	}
+
+	lt.results.TotalRequests++
+	lt.results.FailedReqs++
+	lt.results.ErrorCounts[errorType]++
+	if lt.diagnostics != nil {
+		lt.diagnostics.trace(-1, "error", 0, 0, errorType+": "+err.Error())
+	}
+
+	if categoryInfo, exists := lt.results.ErrorCategories[category]; exists {
+		categoryInfo.record(1, err.Error(), time.Since(lt.results.StartTime))
+	}
+
+	if lt.verbose {
+		log.Printf("Error (%s) [%s]: %v", errorType, category, err)
+	}
+}
+
+// collectMetrics periodically collects and reports metrics
+func (lt *LoadTest) collectMetrics() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			lt.results.mu.RLock()
+			lt.results.mu.Lock()
+			lt.results.Timeline = append(lt.results.Timeline, timelinePoint{
+				Successful: lt.results.SuccessfulReqs,
+				Failed:     lt.results.FailedReqs,
+			})
+			lt.results.Resources.sample()
 			rps := float64(lt.results.TotalRequests) / time.Since(lt.results.StartTime).Seconds()
 			peakResponseTime := lt.results.PeakResponseTime
+			totalRequests, failedReqs := lt.results.TotalRequests, lt.results.FailedReqs
 
 			// Collect error category counts for metrics
 			errorCategoryMetrics := make(map[string]int)
 			for category, info := range lt.results.ErrorCategories {
 				errorCategoryMetrics[category] = info.Count
 			}
-			lt.results.mu.RUnlock()
+			lt.results.mu.Unlock()
 
 			// Record RPS metric
 			lt.metrics.SetGaugeWithLabels([]string{"rps"}, float32(rps), []metrics.Label{
@@ -462,6 +1921,36 @@ func (lt *LoadTest) collectMetrics() {
 					{Name: "category", Value: category},
 				})
 			}
+
+			// Buffer the same samples for --remote-write
+			if lt.remote != nil {
+				now := time.Now()
+				labels := []promLabel{{Name: "job", Value: "ws-load"}, {Name: "url", Value: lt.opts.URL}}
+				lt.remote.add("wsload_requests_per_second", labels, rps, now)
+				lt.remote.add("wsload_requests_total", labels, float64(totalRequests), now)
+				lt.remote.add("wsload_requests_failed_total", labels, float64(failedReqs), now)
+				lt.remote.add("wsload_peak_response_time_seconds", labels, peakResponseTime.Seconds(), now)
+				for category, count := range errorCategoryMetrics {
+					lt.remote.add("wsload_errors_total", append(labels, promLabel{Name: "category", Value: category}), float64(count), now)
+				}
+			}
+		case <-lt.ctx.Done():
+			return
+		}
+	}
+}
+
+// pushRemoteMetrics periodically sends buffered samples to --remote-write
+func (lt *LoadTest) pushRemoteMetrics() {
+	ticker := time.NewTicker(remoteWriteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := lt.remote.flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
 		case <-lt.ctx.Done():
 			return
 		}
@@ -478,46 +1967,213 @@ func (lt *LoadTest) printResults() {
 	successfulReqs := lt.results.SuccessfulReqs
 	failedReqs := lt.results.FailedReqs
 
-	var avgLatency time.Duration
-	if successfulReqs > 0 {
-		avgLatency = lt.results.TotalLatency / time.Duration(successfulReqs)
-	}
-
-	// Calculate P50 latency
-	var p50Latency time.Duration
-	if len(lt.results.Latencies) > 0 {
-		// Simple P50 calculation (for production, use proper percentile calculation)
-		p50Latency = lt.results.Latencies[len(lt.results.Latencies)/2]
-	}
+	avgLatency := lt.results.avgLatency()
 
 	rps := float64(totalRequests) / duration.Seconds()
 	throughput := float64(lt.results.BytesSent+lt.results.BytesReceived) / duration.Seconds()
 
 	fmt.Printf("\n\n")
-	fmt.Printf("╔══════════════════════════════════════════════════════════════╗\n")
-	fmt.Printf("║                    WebSocket Load Test Results              ║\n")
-	fmt.Printf("╚══════════════════════════════════════════════════════════════╝\n")
+	printBanner("WebSocket Load Test Results")
 	fmt.Printf("\n")
 	fmt.Printf("Test Configuration:\n")
 	fmt.Printf("  URL:         %s\n", lt.opts.URL)
 	fmt.Printf("  Duration:    %s\n", duration)
 	fmt.Printf("  Connections: %d\n", lt.opts.Connections)
-	fmt.Printf("  Message:     %s\n", lt.opts.Message)
-	fmt.Printf("  Loop Count:  %d\n", lt.opts.Loop)
+	if lt.opts.JSONTemplate != "" {
+		fmt.Printf("  Template:    %s\n", lt.opts.JSONTemplate)
+	} else if lt.messages != nil {
+		fmt.Printf("  Messages:    %s (%d messages)\n", lt.opts.MessagesFile, len(lt.messages))
+	} else if lt.opts.SizeDist != "" {
+		fmt.Printf("  Size Dist:   %s\n", lt.opts.SizeDist)
+	} else if lt.opts.MessageFile != "" {
+		fmt.Printf("  Message:     %s (%d bytes)\n", lt.opts.MessageFile, len(lt.message))
+	} else {
+		fmt.Printf("  Message:     %s\n", lt.opts.Message)
+		if lt.opts.MessageEncoding == "base64" {
+			fmt.Printf("  Encoding:    base64 (%d bytes decoded, binary frames)\n", len(lt.message))
+		}
+	}
+	if lt.opts.Requests > 0 {
+		fmt.Printf("  Requests:    %d (shared by all connections)\n", lt.opts.Requests)
+	} else {
+		fmt.Printf("  Loop Count:  %s\n", loopCount(lt.opts.Loop))
+	}
 	fmt.Printf("\n")
 	fmt.Printf("Performance Metrics:\n")
 	fmt.Printf("  Total Requests:     %d\n", totalRequests)
 	fmt.Printf("  Successful:         %d (%.1f%%)\n", successfulReqs, float64(successfulReqs)/float64(totalRequests)*100)
 	fmt.Printf("  Failed:             %d (%.1f%%)\n", failedReqs, float64(failedReqs)/float64(totalRequests)*100)
 	fmt.Printf("  Requests/sec:       %.2f\n", rps)
-	fmt.Printf("  Avg Latency:        %s\n", avgLatency)
-	fmt.Printf("  P50 Latency:        %s\n", p50Latency)
-	fmt.Printf("  Peak Response Time: %s\n", lt.results.PeakResponseTime)
+	if lt.opts.Rate > 0 {
+		fmt.Printf("  Offered Rate:       %.2f (--rate %g × %d connections)\n",
+			lt.opts.Rate*float64(lt.opts.Connections), lt.opts.Rate, lt.opts.Connections)
+	}
+	fmt.Printf("  Avg Latency:        %s\n", formatLatency(avgLatency, lt.opts.LatencyUnit))
+	for i, latency := range lt.latencyPercentiles(lt.opts.Percentiles) {
+		fmt.Printf("  %-20s%s\n", percentileLabel(lt.opts.Percentiles[i])+" Latency:", formatLatency(latency, lt.opts.LatencyUnit))
+	}
+	fmt.Printf("  Peak Response Time: %s\n", formatLatency(lt.results.PeakResponseTime, lt.opts.LatencyUnit))
+	if lt.results.Writes > 0 {
+		fmt.Printf("  Write Latency:      %s avg, %s P99 (time for a send to return)\n",
+			formatLatency(lt.results.avgWriteLatency(), lt.opts.LatencyUnit),
+			formatLatency(lt.results.WriteLatency.valueAtPercentile(99), lt.opts.LatencyUnit))
+	}
+	if lt.results.RoundTrips == 0 && lt.results.Writes > 0 {
+		fmt.Printf("  No responses arrived, so no round-trip latency was measured\n")
+	} else if unpaired := lt.unpaired.Load(); unpaired > 0 {
+		fmt.Printf("  Unpaired Messages:  %d (the server does not answer each message exactly once, so round-trip latency may be skewed)\n", unpaired)
+	}
 	fmt.Printf("  Throughput:         %.2f bytes/sec\n", throughput)
 	fmt.Printf("  Bytes Sent:         %d\n", lt.results.BytesSent)
 	fmt.Printf("  Bytes Received:     %d\n", lt.results.BytesReceived)
+	fmt.Printf("  Messages Received:  %d (%.2f/sec)\n", lt.results.MessagesReceived, float64(lt.results.MessagesReceived)/duration.Seconds())
+	if availability, ok := lt.results.connectionAvailability(); ok {
+		fmt.Printf("  Conn Availability:  %.1f%%\n", availability)
+	}
+	if lt.opts.MaxBandwidth > 0 {
+		fmt.Printf("  Send Bandwidth:     %s/s (capped at %s/s)\n",
+			formatBytes(int64(float64(lt.results.BytesSent)/duration.Seconds())), formatBytes(int64(lt.opts.MaxBandwidth)))
+	}
+	if lt.slots != nil {
+		average, peak := lt.slots.achieved(lt.results.EndTime)
+		fmt.Printf("  Concurrency:        %.1f avg in flight, %d peak (target %d)\n", average, peak, lt.opts.TargetConcurrency)
+	}
+	if lt.opts.SendQueueSize > 0 {
+		fmt.Printf("  Dropped Messages:   %d\n", lt.results.DroppedMessages)
+	}
+	if lt.opts.ReconnectOn != "never" {
+		fmt.Printf("  Reconnects:         %d (%d server closes, --reconnect-on %s)\n", lt.results.Reconnects, lt.results.ServerCloses, lt.opts.ReconnectOn)
+	}
+	if lt.results.CancelledReqs > 0 {
+		fmt.Printf("  Cancelled at End:   %d (not counted as failures)\n", lt.results.CancelledReqs)
+	}
+	if consumed, ok := lt.results.errorBudgetConsumed(lt.opts.SLOAvailability); ok && lt.opts.SLOAvailability > 0 {
+		verdict := "within budget"
+		if consumed > 100 {
+			verdict = "over budget"
+		}
+		fmt.Printf("  SLO Availability:   %.1f%% achieved, target %g%% over %s\n",
+			float64(successfulReqs)/float64(totalRequests)*100, lt.opts.SLOAvailability, duration.Round(time.Second))
+		fmt.Printf("  Error Budget:       %.0f%% consumed (%s)\n", consumed, verdict)
+	}
+	if lt.opts.ExpectReceived > 0 {
+		qualifier := "≥"
+		if lt.opts.ExactReceived {
+			qualifier = "="
+		}
+		fmt.Printf("  Expected Received:  %s%d per connection (%d connections missed it)\n", qualifier, lt.opts.ExpectReceived, lt.results.ShortConnections)
+	}
+	fmt.Printf("\n")
+
+	// Show when failures happened, not just how many
+	if sparkline, secondsPerChar := successSparkline(lt.results.Timeline, sparklineWidth); len(lt.results.Timeline) > 1 {
+		fmt.Printf("Success Rate Timeline (%ds/char, ▁ = 0%%, █ = 100%%):\n", secondsPerChar)
+		fmt.Printf("  %s\n", sparkline)
+		if cov, ok := rpsCoefficientOfVariation(lt.results.Timeline); ok {
+			fmt.Printf("  RPS CoV:            %.3f\n", cov)
+		}
+		fmt.Printf("\n")
+	}
+
+	if lt.pause != nil {
+		if paused, total := lt.pause.summary(duration); paused != "" {
+			fmt.Printf("Paused Intervals (%.1fs in total, SIGUSR1/SIGUSR2):\n", total.Seconds())
+			fmt.Printf("  %s\n", paused)
+			fmt.Printf("\n")
+		}
+	}
+
+	if len(lt.results.ConnectionTimeline) > 1 {
+		changes := make([]string, 0, len(lt.results.ConnectionTimeline))
+		for _, change := range lt.results.ConnectionTimeline {
+			changes = append(changes, fmt.Sprintf("+%.1fs %d", change.At.Seconds(), change.Count))
+		}
+		fmt.Printf("Connection Count Timeline:\n")
+		fmt.Printf("  %s\n", strings.Join(changes, " → "))
+		fmt.Printf("\n")
+	}
+
+	if lt.opts.ConnectionLifetime > 0 {
+		lifetimes := append([]time.Duration(nil), lt.results.ConnLifetimes...)
+		fmt.Printf("Connection Churn:\n")
+		fmt.Printf("  Connections Created: %d\n", lt.results.EstablishedConns)
+		if len(lifetimes) > 0 {
+			var total time.Duration
+			for _, lifetime := range lifetimes {
+				total += lifetime
+			}
+			fmt.Printf("  Avg Lifetime:        %s\n", (total / time.Duration(len(lifetimes))).Round(time.Millisecond))
+			fmt.Printf("  P50 Lifetime:        %s\n", calculatePercentile(lifetimes, 50).Round(time.Millisecond))
+			fmt.Printf("  Min / Max Lifetime:  %s / %s\n", slices.Min(lifetimes).Round(time.Millisecond), slices.Max(lifetimes).Round(time.Millisecond))
+		}
+		fmt.Printf("\n")
+	}
+
+	if len(lt.results.HandshakeHeaders) > 0 {
+		fmt.Printf("Handshake Response Headers:\n")
+		names := make([]string, 0, len(lt.results.HandshakeHeaders))
+		for name := range lt.results.HandshakeHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, strings.Join(lt.results.HandshakeHeaders[name], ", "))
+		}
+		fmt.Printf("\n")
+	}
+
+	if lt.opts.SendOnConnectOnly {
+		lt.printServerPush()
+	}
+
+	if lt.messages != nil {
+		lt.printMessageLatencies()
+	}
+
+	// The generator's own load shows whether the numbers above are trustworthy
+	resources := lt.results.Resources
+	fmt.Printf("Load Generator:\n")
+	fmt.Printf("  CPU Usage:          %.1f%% of %d CPUs (%s CPU time)\n", resources.CPUPercent, runtime.NumCPU(), resources.CPUTime.Round(time.Millisecond))
+	fmt.Printf("  Peak Heap:          %s\n", formatBytes(int64(resources.PeakHeap)))
+	if resources.PeakRSS > 0 {
+		fmt.Printf("  Peak RSS:           %s\n", formatBytes(resources.PeakRSS))
+	}
+	if resources.saturated() {
+		fmt.Printf("  ⚠️  The load generator was CPU-bound; throughput may be limited by the client, not the server\n")
+	}
+	if fairness, ok := computeSendFairness(lt.results.ConnRequests); ok {
+		fmt.Printf("  Requests/Conn:      min %d, max %d, mean %.1f, stddev %.1f\n", fairness.Min, fairness.Max, fairness.Mean, fairness.StdDev)
+		if fairness.uneven() {
+			fmt.Printf("  ⚠️  Requests were spread unevenly across connections; some connections got far fewer turns\n")
+		}
+	}
 	fmt.Printf("\n")
 
+	if lt.opts.Fuzz {
+		lt.printFuzzResults()
+	}
+
+	if lt.opts.FrameSize > 0 {
+		fmt.Printf("Fragmentation (--frame-size %d):\n", lt.opts.FrameSize)
+		fmt.Printf("  Fragmented Messages: %d (%d frames)\n", lt.results.FragmentedMsgs, lt.results.FragmentFrames)
+		if lt.opts.ValidateEcho {
+			fmt.Printf("  Reassembly:          %d echoes verified, %d integrity failures\n", lt.results.EchoesVerified, lt.results.IntegrityErrors)
+		} else {
+			fmt.Printf("  Reassembly:          not checked (use --validate-echo)\n")
+		}
+		fmt.Printf("\n")
+	}
+
+	if lt.opts.ValidateEcho {
+		fmt.Printf("Echo Integrity:\n")
+		fmt.Printf("  Echoes Verified:    %d\n", lt.results.EchoesVerified)
+		fmt.Printf("  Integrity Failures: %d\n", lt.results.IntegrityErrors)
+		if lt.results.IntegrityExample != "" {
+			fmt.Printf("    └─ %s\n", lt.results.IntegrityExample)
+		}
+		fmt.Printf("\n")
+	}
+
 	if len(lt.results.ErrorCounts) > 0 {
 		fmt.Printf("Error Summary:\n")
 		for errorType, count := range lt.results.ErrorCounts {
@@ -528,7 +2184,8 @@ func (lt *LoadTest) printResults() {
 		// Print Error Categories
 		fmt.Printf("Error Categories:\n")
 		hasErrors := false
-		for category, info := range lt.results.ErrorCategories {
+		for _, category := range lt.results.sortedErrorCategories() {
+			info := lt.results.ErrorCategories[category]
 			if info.Count > 0 {
 				hasErrors = true
 				fmt.Printf("  %s: %d (%.1f%%)\n",
@@ -536,6 +2193,7 @@ func (lt *LoadTest) printResults() {
 					info.Count,
 					float64(info.Count)/float64(failedReqs)*100)
 				fmt.Printf("    └─ %s\n", info.Description)
+				fmt.Printf("    └─ First seen at +%.1fs\n", info.FirstSeen.Seconds())
 
 				// Show examples if available
 				if len(info.Examples) > 0 {
@@ -554,6 +2212,17 @@ func (lt *LoadTest) printResults() {
 		if !hasErrors {
 			fmt.Printf("  No categorized errors found.\n\n")
 		}
+
+		// Slow-to-upgrade servers look like a wall of timeouts; point at the fix
+		if share, ok := lt.results.handshakeTimeoutShare(); ok {
+			fmt.Printf("💡 %.0f%% of failures were handshake timeouts (%d). If the server is slow to upgrade connections,\n", share*100, lt.results.HandshakeTimeouts)
+			fmt.Printf("   try raising --handshake-timeout (currently %s).\n\n", lt.handshakeTimeout())
+		}
+
+		// A redirected upgrade never succeeds; say where the server points
+		if lt.results.ErrorCategories[ErrorCategoryRedirect].Count > 0 && lt.results.RedirectLocation != "" {
+			fmt.Printf("💡 The server redirected the WebSocket handshake to %s — use that URL instead.\n\n", lt.results.RedirectLocation)
+		}
 	}
 
 	fmt.Printf("Test completed in %s\n", duration)
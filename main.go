@@ -1,13 +1,28 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 )
 
+// Exit codes let CI pipelines tell configuration mistakes apart from genuine
+// test failures
+const (
+	exitSuccess              = 0
+	exitFailure              = 1 // Unclassified runtime error
+	exitConfigError          = 2 // Invalid flags or options
+	exitThresholdBreach      = 3 // A pass/fail threshold was not met
+	exitAborted              = 4 // The test was aborted before completing
+	exitAllConnectionsFailed = 5 // No connection could be established
+)
+
 // GlobalOptions contains options that apply to all commands
 type GlobalOptions struct {
 	Verbose bool `short:"v" long:"verbose" description:"Enable verbose output"`
@@ -15,11 +30,88 @@ type GlobalOptions struct {
 
 // TestOptions contains options for the test command
 type TestOptions struct {
-	URL         string `short:"u" long:"url" description:"WebSocket endpoint URL (e.g., ws://echo.websocket.org)" required:"true"`
-	Duration    string `short:"d" long:"duration" description:"Test duration (e.g., 10s, 5m, 1h)" default:"30s"`
-	Connections int    `short:"c" long:"connections" description:"Number of concurrent connections" default:"10"`
-	Message     string `short:"m" long:"message" description:"Message to send (string or JSON)" default:"Hello, WebSocket!"`
-	Loop        int    `short:"l" long:"loop" description:"Number of times to send message per connection" default:"1"`
+	URL                string          `short:"u" long:"url" description:"WebSocket endpoint URL (e.g., ws://echo.websocket.org); required unless --replay is used"`
+	Duration           string          `short:"d" long:"duration" description:"Test duration (e.g., 10s, 5m, 1h)" default:"30s"`
+	StartAt            string          `long:"start-at" description:"Wait until this wall-clock time (RFC3339, e.g. 2026-01-02T15:04:05Z) before starting, so instances on several machines start their load together"`
+	StartDelay         time.Duration   `long:"start-delay" description:"Wait this long before starting the load (e.g. 30s)" default:"0"`
+	Connections        ConnectionCount `short:"c" long:"connections" description:"Number of concurrent connections, or \"auto\" to size to this machine" default:"10"`
+	Message            string          `short:"m" long:"message" description:"Message to send (string or JSON)" default:"Hello, WebSocket!"`
+	MessageEncoding    string          `long:"message-encoding" description:"Encoding of --message; base64 is decoded and sent as binary frames" choice:"text" choice:"base64" default:"text"`
+	MessageFile        string          `long:"message-file" description:"Send the contents of this file as the message instead of --message; content that is not valid UTF-8 is sent as binary frames"`
+	Loop               int             `short:"l" long:"loop" description:"Number of times to send message per connection (0 sends until the test duration ends)" default:"1"`
+	Continuous         bool            `long:"continuous" description:"Keep sending on each connection until the test duration ends (same as --loop 0)"`
+	Requests           int             `long:"requests" description:"Total number of messages to send, handed out from a shared queue to the connections as they are ready (replaces --loop)"`
+	TargetConcurrency  int             `long:"target-concurrency" description:"Keep this many requests in flight across all connections, starting a new one as each response arrives (closed loop; requires --response-timeout)"`
+	Percentiles        PercentileList  `long:"percentiles" description:"Comma-separated latency percentiles to report (fractions allowed, e.g. 50,90,99,99.9)" default:"50,95,99"`
+	LatencyUnit        string          `long:"latency-unit" description:"Unit for reported latencies, printed as plain numbers with a fixed precision" choice:"ms" choice:"us" choice:"ns" choice:"s" default:"ms"`
+	SendOnConnectOnly  bool            `long:"send-on-connect-only" description:"Send --message once per connection (e.g. a subscribe frame), then only receive server-pushed messages for the rest of the test"`
+	ExpectReceived     int             `long:"expect-received" description:"Fail connections that receive fewer than this many messages, e.g. broadcasts after subscribing (0 disables)"`
+	ExactReceived      bool            `long:"expect-received-exact" description:"With --expect-received, also fail connections that receive more messages than expected"`
+	Binary             bool            `long:"binary" description:"Send messages as binary frames instead of text frames"`
+	FrameSize          int             `long:"frame-size" description:"Split messages larger than this many bytes into continuation frames of at most this size, to exercise server reassembly (0 sends single frames)" default:"0"`
+	Subprotocols       []string        `long:"subprotocol" description:"Request a WebSocket subprotocol (repeatable, in order of preference)"`
+	CaptureHeaders     bool            `long:"capture-headers" description:"Record the response headers of the first successful handshake in the results and history"`
+	JSONTemplate       string          `long:"json-template" description:"JSON message template rendered per message (placeholders: {{uuid}}, {{now}}, {{unixMilli}}, {{.ConnID}}, {{.MsgID}}, {{.Seq}})"`
+	MessagesFile       string          `long:"messages-file" description:"File of messages to send in turn, one per line (optionally label<TAB>message); results break latency down by message"`
+	StrictJSON         bool            `long:"strict-json" description:"Require every message to be valid JSON: fixed messages are checked up front, templated and generated ones after rendering"`
+	FirstMessage       string          `long:"first-message" description:"Message sent once on each connection before the main loop (e.g. an auth or hello frame)"`
+	AwaitFirstResponse bool            `long:"await-first-response" description:"Wait for the server to answer --first-message before sending data"`
+	SizeDist           string          `long:"size-dist" description:"Draw payload sizes from a distribution instead of sending --message (e.g. uniform:100-4096, lognormal:mean=512,sigma=1.5)"`
+	MessageCommand     string          `long:"message-command" description:"Generate payloads with this shell command; each line it prints to stdout is sent as one message"`
+	CommandTimeout     time.Duration   `long:"message-command-timeout" description:"Record a generator failure when --message-command has no payload ready within this long" default:"1s"`
+	Fuzz               bool            `long:"fuzz" description:"Send a rotating corpus of malformed and edge-case frames and report which ones caused errors or disconnects"`
+	FuzzCorpus         string          `long:"fuzz-corpus" description:"Directory of extra --fuzz payloads, one binary frame per file"`
+	Seed               int64           `long:"seed" description:"Random seed for reproducible payload generation (0 picks one at random)" default:"0"`
+	WarnMessageSize    int             `long:"warn-message-size" description:"Warn when a message is larger than this many bytes (0 disables)" default:"1048576"`
+	Strict             bool            `long:"strict" description:"Turn configuration warnings into errors"`
+	MaxRPSCoV          float64         `long:"max-rps-cov" description:"Fail the run if the coefficient of variation of per-second RPS exceeds this value (e.g. 0.2; 0 disables)" default:"0"`
+	FailOnAnyError     bool            `long:"fail-on-any-error" description:"Fail the run if any request failed (cancellations at the end of the test are not failures)"`
+	SaveOnBreach       string          `long:"save-on-threshold-breach" description:"Buffer per-connection stats, recent frame traces and raw latencies, and write them to this JSON file only if a pass/fail check fails"`
+	SLOAvailability    float64         `long:"slo-availability" description:"Availability SLO in percent (e.g. 99.9); report the share of the error budget the run consumed and fail it when over budget (0 disables)" default:"0"`
+	SendQueueSize      int             `long:"send-queue-size" description:"Per-connection send queue size; messages are dropped when the queue is full (0 writes directly)" default:"0"`
+	ValidateEcho       bool            `long:"validate-echo" description:"Verify that every response is a byte-for-byte echo of the message sent"`
+	MetricsFile        string          `long:"metrics-file" description:"Write final metrics to this file in Prometheus text format"`
+	HdrExport          string          `long:"hdr-export" description:"Write the latency distribution to this file in the HdrHistogram log format (values in microseconds)"`
+	CSVLatencies       string          `long:"csv-latencies" description:"Stream every latency sample to this CSV file as it is recorded instead of keeping samples in memory; percentiles then come from a histogram"`
+	ProgressToStderr   bool            `long:"progress-to-stderr" description:"Draw the progress bar on stderr so stdout only carries results"`
+	Output             string          `long:"output" choice:"text" choice:"html" choice:"line" choice:"json" default:"text" description:"Results format on stdout: text, html for a self-contained HTML report, line for a one-line OK/FAIL summary, or json for a single JSON object (progress moves to stderr, and is hidden for json)"`
+	RemoteWrite        string          `long:"remote-write" description:"Push per-second metrics to this Prometheus remote-write endpoint (e.g. Mimir, Cortex, Thanos)"`
+	RemoteWriteHeaders []string        `long:"remote-write-header" description:"Extra header for remote-write requests, e.g. \"Authorization: Bearer TOKEN\" (repeatable)"`
+	NoHistory          bool            `long:"no-history" description:"Do not save this run to the test history"`
+	Tag                string          `long:"tag" description:"Label this run in the history, e.g. staging or prod, for visualize --group-by tag"`
+	Replay             int             `long:"replay" description:"Rerun the configuration (URL, duration, connections, message, loop) of this history entry"`
+	Compare            bool            `long:"compare" description:"With --replay, compare the results against the original run"`
+	BaselineAuto       bool            `long:"baseline-auto" description:"Compare against the most recent history entry for the same URL and fail on regression"`
+	MaxRegression      float64         `long:"max-regression" description:"With --baseline-auto, the largest tolerated regression in percent (success rate in percentage points)" default:"10"`
+	CompareMode        string          `long:"compare-mode" description:"Whether --max-regression is a percentage of the baseline or an absolute change (req/s, ms)" choice:"percent" choice:"absolute" default:"percent"`
+	Check              bool            `long:"check" description:"Validate options, resolve DNS and complete one handshake, then exit without generating load"`
+	DebugSingle        bool            `long:"debug-single" description:"Open one connection and print a sequential trace of the handshake and every message sent and received, waiting for each response; no load is generated"`
+	PrintConfig        bool            `long:"print-config" description:"Print the fully resolved configuration as JSON (credentials redacted) and exit without running"`
+	Retention          string          `long:"retention" description:"Prune history after saving: keep the last N entries (e.g. 100) or the last N days (e.g. 30d)"`
+
+	HandshakeTimeout   time.Duration `long:"handshake-timeout" description:"Maximum time to complete the TLS and WebSocket upgrade, and to connect unless --tcp-connect-timeout is set" default:"10s"`
+	TCPConnectTimeout  time.Duration `long:"tcp-connect-timeout" description:"Maximum time for the TCP connect alone; 0 uses --handshake-timeout" default:"0"`
+	MaxConnectFailures int           `long:"max-connect-failures" description:"Abort the test after this many consecutive handshake failures while the initial connections are opening (0 disables)" default:"0"`
+	ReadTimeout        time.Duration `long:"read-timeout" description:"Close a connection that receives nothing for this long (0 disables)" default:"0"`
+	ResponseTimeout    time.Duration `long:"response-timeout" description:"Count a message as a timeout failure when its response does not arrive within this long; latency becomes the round trip (0 disables)" default:"0"`
+	IdleTimeout        time.Duration `long:"idle-timeout" description:"Close a connection as half-open when nothing arrives for this long while responses are outstanding (0 disables)" default:"0"`
+	WriteTimeout       time.Duration `long:"write-timeout" description:"Maximum time a single message write may block (0 disables)" default:"0"`
+	TCPNoDelay         string        `long:"tcp-nodelay" description:"Disable Nagle's algorithm on each connection" choice:"on" choice:"off" default:"on"`
+	SocketBuffer       int           `long:"socket-buffer" description:"Socket send and receive buffer size in bytes (0 keeps the OS default)" default:"0"`
+	MaxBandwidth       ByteRate      `long:"max-bandwidth" description:"Cap aggregate send bandwidth across all connections (e.g. 10MB/s; 0 is unlimited)" default:"0"`
+	Rate               float64       `long:"rate" description:"Send this many messages per second on each connection, however fast writes return (0 is unlimited)" default:"0"`
+	Resolve            []string      `long:"resolve" description:"Connect to IP for host:port while keeping the hostname for Host and SNI, like curl (host:port:ip; repeatable)"`
+	DrainTimeout       time.Duration `long:"drain-timeout" description:"After the test ends, keep reading for up to this long to collect in-flight responses (0 disables)" default:"0"`
+	RampUp             time.Duration `long:"ramp-up" description:"Open connections gradually over this window at the start of the test (e.g. 30s)" default:"0"`
+	RampDown           time.Duration `long:"ramp-down" description:"Close connections gradually over this window at the end of the test (e.g. 10s)" default:"0"`
+	ConnectionLifetime time.Duration `long:"connection-lifetime" description:"Close and replace each connection after it has been open this long (0 keeps connections for the whole test)" default:"0"`
+	ReconnectOn        string        `long:"reconnect-on" description:"Reconnect when the server closes a connection mid-test: never, only after abnormal closes (anything but 1000/1001, e.g. 1006), or after any close" choice:"never" choice:"abnormal" choice:"all" default:"never"`
+	ControlFile        string        `long:"control-file" description:"Poll this file once per second and scale to the connection count it contains"`
+
+	// messageFile holds the contents of --message-file, read once by
+	// validateTestOptions; messageSet records whether --message was given
+	messageFile []byte
+	messageSet  bool
 }
 
 // ConfigOptions contains options for the config command
@@ -29,15 +121,25 @@ type ConfigOptions struct {
 
 // HistoryOptions contains options for the history command
 type HistoryOptions struct {
-	Show  bool `short:"s" long:"show" description:"Show test history"`
-	Limit int  `short:"l" long:"limit" description:"Number of recent tests to show" default:"10"`
-	Clear bool `short:"c" long:"clear" description:"Clear all test history"`
+	Show      bool   `short:"s" long:"show" description:"Show test history"`
+	Limit     int    `short:"l" long:"limit" description:"Number of recent tests to show" default:"10"`
+	Clear     bool   `short:"c" long:"clear" description:"Clear all test history"`
+	ShowEntry int    `long:"show-entry" description:"Show every recorded field of a single test by ID"`
+	Table     bool   `long:"table" description:"Show history as a compact table, one row per test"`
+	Prune     bool   `long:"prune" description:"Remove entries outside the --retention policy"`
+	Retention string `long:"retention" description:"Retention policy for --prune: keep the last N entries (e.g. 100) or the last N days (e.g. 30d)"`
+	Config    string `long:"config-hash" description:"Only show tests whose config hash starts with this value"`
+	Export    string `long:"export" description:"Write the history to stdout for data tooling instead of listing it (jsonl: one compact JSON object per test, csv: a header row and one row per test)" choice:"jsonl" choice:"csv"`
+	File      string `long:"file" description:"Write --export to this file instead of stdout"`
 }
 
 // VisualizeOptions contains options for the visualize command
 type VisualizeOptions struct {
-	Metric string `short:"m" long:"metric" description:"Metric to visualize (success-rate, requests-per-sec, avg-latency, throughput)" default:"success-rate"`
-	Limit  int    `short:"l" long:"limit" description:"Number of recent tests to include" default:"10"`
+	Metric  string `short:"m" long:"metric" description:"Metric to visualize (success-rate, requests-per-sec, avg-latency, p90-latency, p95-latency, p99-latency, throughput)" default:"success-rate"`
+	Limit   int    `short:"l" long:"limit" description:"Number of recent tests to include" default:"10"`
+	GroupBy string `long:"group-by" description:"Render a separate series per group" choice:"url" choice:"tag" choice:"connections" choice:"config"`
+	XAxis   string `long:"x-axis" description:"Label runs by history ID or by when they ran" choice:"id" choice:"time" default:"id"`
+	Config  string `long:"config-hash" description:"Only include tests whose config hash starts with this value"`
 }
 
 // Commands structure for the CLI
@@ -59,7 +161,6 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to add test command:", err)
 	}
-	_ = testCmd
 
 	configCmd, err := parser.AddCommand("config", "Manage configuration", "View and modify tool configuration", &commands.Config)
 	if err != nil {
@@ -95,30 +196,38 @@ Features:
 Examples:
   ws-load test -u ws://echo.websocket.org -d 30s -c 50
   ws-load test --url ws://localhost:8080/ws --duration 5m --connections 100 --message '{"type":"ping"}'
+  ws-load test -u ws://localhost:8080/ws --check
+  ws-load test --replay 3 --compare
   ws-load config --show
   ws-load history --limit 5
-  ws-load visualize --metric requests-per-sec --limit 10`
+  ws-load history --show-entry 3
+  ws-load history --table --limit 50
+  ws-load visualize --metric requests-per-sec --limit 10
+  ws-load visualize --metric success-rate --group-by url`
 
 	// Parse command line arguments
 	_, parseErr := parser.Parse()
 	if parseErr != nil {
 		if flagsErr, ok := parseErr.(*flags.Error); ok {
 			if flagsErr.Type == flags.ErrHelp {
-				os.Exit(0)
+				os.Exit(exitSuccess)
 			}
 		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 	}
 
 	// Handle commands
 	if parser.Active == nil {
 		parser.WriteHelp(os.Stdout)
-		os.Exit(0)
+		os.Exit(exitSuccess)
 	}
 
 	switch parser.Active.Name {
 	case "test":
+		if option := testCmd.FindOptionByLongName("message"); option != nil {
+			commands.Test.messageSet = option.IsSet() && !option.IsSetDefault()
+		}
 		runTest(&commands.Test, &globalOpts)
 	case "config":
 		runConfig(&commands.Config, &globalOpts)
@@ -128,50 +237,394 @@ Examples:
 		runVisualize(&commands.Visualize, &globalOpts)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", parser.Active.Name)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 	}
 }
 
 func runTest(opts *TestOptions, globalOpts *GlobalOptions) {
+	notices := noticeWriter(opts.Output)
+
+	// Rerun the configuration of a previous test
+	var replayed *TestHistoryEntry
+	if opts.Replay > 0 {
+		history, err := loadHistory()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading history: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		replayed, err = history.getEntryByID(opts.Replay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: cannot replay: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		replayed.applyTo(opts)
+		fmt.Fprintf(notices, "Replaying test #%d: %s for %s with %d connections\n", replayed.ID, opts.URL, opts.Duration, opts.Connections)
+	}
+
 	// Validate test options
 	if err := validateTestOptions(opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitConfigError)
+	}
+
+	// Show what would run, after replay and validation, then stop
+	if opts.PrintConfig {
+		if err := printEffectiveConfig(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		return
 	}
 
 	if globalOpts.Verbose {
-		fmt.Printf("Starting WebSocket load test...\n")
-		fmt.Printf("URL: %s\n", opts.URL)
-		fmt.Printf("Duration: %s\n", opts.Duration)
-		fmt.Printf("Connections: %d\n", opts.Connections)
-		fmt.Printf("Message: %s\n", sanitizeMessage(opts.Message, 100))
-		fmt.Printf("Loop count: %d\n", opts.Loop)
-		fmt.Printf("Verbose mode: enabled\n")
+		fmt.Fprintf(notices, "Starting WebSocket load test...\n")
+		fmt.Fprintf(notices, "URL: %s\n", opts.URL)
+		fmt.Fprintf(notices, "Duration: %s\n", opts.Duration)
+		fmt.Fprintf(notices, "Connections: %d\n", opts.Connections)
+		if opts.JSONTemplate != "" {
+			fmt.Fprintf(notices, "JSON template: %s\n", sanitizeMessage(opts.JSONTemplate, 100))
+		} else if opts.MessagesFile != "" {
+			fmt.Fprintf(notices, "Messages file: %s\n", opts.MessagesFile)
+		} else if opts.MessageFile != "" {
+			fmt.Fprintf(notices, "Message file: %s (%d bytes)\n", opts.MessageFile, len(opts.messageFile))
+		} else {
+			fmt.Fprintf(notices, "Message: %s\n", sanitizeMessage(opts.Message, 100))
+			if opts.MessageEncoding == "base64" {
+				fmt.Fprintf(notices, "Message encoding: base64 (sent as binary frames)\n")
+			}
+		}
+		if opts.Requests > 0 {
+			fmt.Fprintf(notices, "Requests: %d over %d connections\n", opts.Requests, opts.Connections)
+		} else {
+			fmt.Fprintf(notices, "Loop count: %s\n", loopCount(opts.Loop))
+		}
+		if opts.TargetConcurrency > 0 {
+			fmt.Fprintf(notices, "Target concurrency: %d requests in flight\n", opts.TargetConcurrency)
+		}
+		if opts.SendOnConnectOnly {
+			fmt.Fprintf(notices, "Mode: send on connect only (receive server pushes)\n")
+		}
+		if opts.Binary {
+			fmt.Fprintf(notices, "Frame type: binary\n")
+		}
+		if opts.FrameSize > 0 {
+			fmt.Fprintf(notices, "Frame size: %d bytes (larger messages are fragmented)\n", opts.FrameSize)
+		}
+		if opts.FirstMessage != "" {
+			fmt.Fprintf(notices, "First message: %s (await response: %t)\n", sanitizeMessage(opts.FirstMessage, 100), opts.AwaitFirstResponse)
+		}
+		if opts.MessageCommand != "" {
+			fmt.Fprintf(notices, "Message command: %s (timeout %s)\n", opts.MessageCommand, opts.CommandTimeout)
+		}
+		if opts.Fuzz {
+			fmt.Fprintf(notices, "Fuzzing: enabled\n")
+			if opts.FuzzCorpus != "" {
+				fmt.Fprintf(notices, "Fuzz corpus: %s\n", opts.FuzzCorpus)
+			}
+		}
+		if opts.SizeDist != "" {
+			fmt.Fprintf(notices, "Size distribution: %s\n", opts.SizeDist)
+		}
+		if len(opts.Subprotocols) > 0 {
+			fmt.Fprintf(notices, "Subprotocols: %s\n", strings.Join(opts.Subprotocols, ", "))
+		}
+		if opts.SendQueueSize > 0 {
+			fmt.Fprintf(notices, "Send queue size: %d\n", opts.SendQueueSize)
+		}
+		if opts.ValidateEcho {
+			fmt.Fprintf(notices, "Echo validation: enabled\n")
+		}
+		if opts.RemoteWrite != "" {
+			fmt.Fprintf(notices, "Remote write: %s\n", opts.RemoteWrite)
+		}
+		fmt.Fprintf(notices, "Handshake timeout: %s\n", opts.HandshakeTimeout)
+		if opts.TCPConnectTimeout > 0 {
+			fmt.Fprintf(notices, "TCP connect timeout: %s\n", opts.TCPConnectTimeout)
+		}
+		if opts.MaxConnectFailures > 0 {
+			fmt.Fprintf(notices, "Max consecutive connect failures: %d\n", opts.MaxConnectFailures)
+		}
+		if opts.ReadTimeout > 0 {
+			fmt.Fprintf(notices, "Read timeout: %s\n", opts.ReadTimeout)
+		}
+		if opts.WriteTimeout > 0 {
+			fmt.Fprintf(notices, "Write timeout: %s\n", opts.WriteTimeout)
+		}
+		if opts.ResponseTimeout > 0 {
+			fmt.Fprintf(notices, "Response timeout: %s\n", opts.ResponseTimeout)
+		}
+		if opts.IdleTimeout > 0 {
+			fmt.Fprintf(notices, "Idle timeout: %s\n", opts.IdleTimeout)
+		}
+		if opts.DrainTimeout > 0 {
+			fmt.Fprintf(notices, "Drain timeout: %s\n", opts.DrainTimeout)
+		}
+		if opts.RampUp > 0 {
+			fmt.Fprintf(notices, "Ramp-up: %s\n", opts.RampUp)
+		}
+		if opts.RampDown > 0 {
+			fmt.Fprintf(notices, "Ramp-down: %s\n", opts.RampDown)
+		}
+		if opts.FailOnAnyError {
+			fmt.Fprintf(notices, "Fail on any error: enabled\n")
+		}
+		if opts.SLOAvailability > 0 {
+			fmt.Fprintf(notices, "SLO availability: %g%%\n", opts.SLOAvailability)
+		}
+		if opts.BaselineAuto {
+			fmt.Fprintf(notices, "Baseline: latest history entry for this URL (max regression %.1f%%)\n", opts.MaxRegression)
+		}
+		if opts.MaxRPSCoV > 0 {
+			fmt.Fprintf(notices, "Max RPS CoV: %.3f\n", opts.MaxRPSCoV)
+		}
+		if opts.ConnectionLifetime > 0 {
+			fmt.Fprintf(notices, "Connection lifetime: %s\n", opts.ConnectionLifetime)
+		}
+		if opts.ControlFile != "" {
+			fmt.Fprintf(notices, "Control file: %s\n", opts.ControlFile)
+		}
+		fmt.Fprintf(notices, "TCP_NODELAY: %s\n", opts.TCPNoDelay)
+		if opts.SocketBuffer > 0 {
+			fmt.Fprintf(notices, "Socket buffer: %d bytes\n", opts.SocketBuffer)
+		}
+		for _, override := range opts.Resolve {
+			fmt.Fprintf(notices, "Resolve override: %s\n", override)
+		}
+		if opts.Rate > 0 {
+			fmt.Fprintf(notices, "Rate: %g messages/sec per connection\n", opts.Rate)
+		}
+		if opts.MaxBandwidth > 0 {
+			fmt.Fprintf(notices, "Max bandwidth: %s/s\n", formatBytes(int64(opts.MaxBandwidth)))
+		}
+		fmt.Fprintf(notices, "Verbose mode: enabled\n")
 	}
 
 	// Create and run the load test
 	test := NewLoadTest(opts)
 	test.verbose = globalOpts.Verbose // Set verbose mode
 
+	// Pre-flight only: exit before generating any load
+	if opts.Check {
+		if err := test.check(); err != nil {
+			fmt.Fprintf(os.Stderr, "Check failed: %v\n", err)
+			os.Exit(exitAllConnectionsFailed)
+		}
+		fmt.Fprintf(notices, "CHECKPASSED: configuration is valid and %s is reachable\n", opts.URL)
+		return
+	}
+
+	// Diagnostics only: trace one connection instead of generating load
+	if opts.DebugSingle {
+		if err := test.runDebugSingle(); err != nil {
+			fmt.Fprintf(os.Stderr, "Debug trace failed: %v\n", err)
+			os.Exit(exitAllConnectionsFailed)
+		}
+		return
+	}
+
 	if err := test.Run(); err != nil {
+		var cfgErr *configError
+		if errors.As(err, &cfgErr) {
+			fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
 		fmt.Fprintf(os.Stderr, "Test failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFailure)
+	}
+	switch opts.Output {
+	case "html":
+		if err := test.writeHTMLReport(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write HTML report: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	case "json":
+		if err := test.writeJSONResults(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to write JSON results: %v\n", err)
+			os.Exit(exitFailure)
+		}
+	case "line":
+		// Printed after the pass/fail gates below
+	default:
+		test.printResults()
+	}
+
+	if opts.Compare {
+		printComparison(notices, *replayed, newHistoryEntry(test), "Original", "Replay")
+	}
+
+	// Look up the baseline before this run is saved, so it cannot match itself
+	var baseline *TestHistoryEntry
+	var regressions []string
+	if opts.BaselineAuto {
+		baseline, regressions = compareWithBaseline(test, notices)
 	}
 
-	// Save test results to history
+	// Write Prometheus metrics file if requested
+	if opts.MetricsFile != "" {
+		if err := test.writeMetricsFile(opts.MetricsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if globalOpts.Verbose {
+			fmt.Fprintf(notices, "Metrics written to %s\n", opts.MetricsFile)
+		}
+	}
+
+	// Write the HdrHistogram log if requested
+	if opts.HdrExport != "" {
+		if err := test.writeHistogramFile(opts.HdrExport); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if globalOpts.Verbose {
+			fmt.Fprintf(notices, "Latency histogram written to %s\n", opts.HdrExport)
+		}
+	}
+	if opts.CSVLatencies != "" && globalOpts.Verbose {
+		fmt.Fprintf(notices, "Latency samples written to %s\n", opts.CSVLatencies)
+	}
+
+	if opts.NoHistory {
+		if globalOpts.Verbose {
+			fmt.Fprintf(notices, "Skipping history (--no-history).\n")
+		}
+	} else {
+		saveToHistory(test, globalOpts, notices)
+	}
+
+	// The summary line goes out once the gates have decided the verdict
+	code, problems := evaluateGates(test, baseline, regressions)
+	if opts.Output == "line" {
+		fmt.Println(test.summaryLine(code == 0))
+	}
+	fmt.Fprint(os.Stderr, problems)
+	if code == exitThresholdBreach && opts.SaveOnBreach != "" {
+		if err := test.writeDiagnostics(opts.SaveOnBreach, strings.TrimSpace(problems)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Diagnostics written to %s\n", opts.SaveOnBreach)
+		}
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// noticeWriter returns where runTest prints everything besides the results: a
+// replay notice, a baseline comparison, --verbose output. That is stdout for
+// the text report and stderr for html, line and json, so stdout carries only
+// the results.
+func noticeWriter(output string) io.Writer {
+	if output != "" && output != "text" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// evaluateGates applies the pass/fail checks of a finished test in order and
+// returns the exit code of the first that fails (0 if all pass) together with
+// the messages to print on stderr
+func evaluateGates(test *LoadTest, baseline *TestHistoryEntry, regressions []string) (int, string) {
+	opts := test.opts
+	var b strings.Builder
+
+	if test.abortReason != "" {
+		fmt.Fprintf(&b, "Test aborted: %s\n", test.abortReason)
+		return exitAborted, b.String()
+	}
+
+	if test.results.EstablishedConns == 0 {
+		fmt.Fprintf(&b, "Error: all %d connections failed\n", opts.Connections)
+		return exitAllConnectionsFailed, b.String()
+	}
+
+	// Zero tolerance: any failure fails the run
+	if opts.FailOnAnyError && test.results.FailedReqs > 0 {
+		fmt.Fprintf(&b, "Threshold breach: %d failed requests (--fail-on-any-error)\n", test.results.FailedReqs)
+		for _, category := range test.results.sortedErrorCategories() {
+			if count := test.results.ErrorCategories[category].Count; count > 0 {
+				fmt.Fprintf(&b, "  %s: %d\n", category, count)
+			}
+		}
+		return exitThresholdBreach, b.String()
+	}
+
+	// Fan-out completeness: every connection must have received its messages
+	if opts.ExpectReceived > 0 && test.results.ShortConnections > 0 {
+		fmt.Fprintf(&b, "Threshold breach: %d connections did not receive the expected %d messages (--expect-received)\n",
+			test.results.ShortConnections, opts.ExpectReceived)
+		return exitThresholdBreach, b.String()
+	}
+
+	// Gate on the availability SLO's error budget
+	if opts.SLOAvailability > 0 {
+		if consumed, ok := test.results.errorBudgetConsumed(opts.SLOAvailability); ok && consumed > 100 {
+			fmt.Fprintf(&b, "Threshold breach: error budget consumed %.0f%% (%d failed of %d requests, --slo-availability %g)\n",
+				consumed, test.results.FailedReqs, test.results.TotalRequests, opts.SLOAvailability)
+			return exitThresholdBreach, b.String()
+		}
+	}
+
+	// Gate on throughput stability
+	if opts.MaxRPSCoV > 0 {
+		cov, ok := rpsCoefficientOfVariation(test.results.Timeline)
+		if !ok {
+			fmt.Fprintf(&b, "Warning: not enough per-second data to check RPS stability\n")
+		} else if cov > opts.MaxRPSCoV {
+			fmt.Fprintf(&b, "Threshold breach: RPS coefficient of variation %.3f exceeds --max-rps-cov %.3f\n", cov, opts.MaxRPSCoV)
+			return exitThresholdBreach, b.String()
+		}
+	}
+
+	// Gate on regression against the automatic baseline
+	if len(regressions) > 0 {
+		fmt.Fprintf(&b, "Threshold breach: regression against baseline test #%d (--max-regression %.1f)\n", baseline.ID, opts.MaxRegression)
+		for _, regression := range regressions {
+			fmt.Fprintf(&b, "  %s\n", regression)
+		}
+		return exitThresholdBreach, b.String()
+	}
+
+	return 0, b.String()
+}
+
+// compareWithBaseline prints to w a comparison with the most recent history
+// entry for the same URL and returns it with any regressions beyond
+// --max-regression. A missing baseline is not a failure.
+func compareWithBaseline(test *LoadTest, w io.Writer) (*TestHistoryEntry, []string) {
+	history, err := loadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not load history for --baseline-auto: %v\n", err)
+		return nil, nil
+	}
+
+	baseline := history.latestForURL(test.opts.URL)
+	if baseline == nil {
+		fmt.Fprintf(w, "No baseline found for %s; skipping regression check.\n\n", test.opts.URL)
+		return nil, nil
+	}
+
+	current := newHistoryEntry(test)
+	printComparison(w, *baseline, current, "Baseline", "Current")
+	return baseline, findRegressions(*baseline, current, test.opts.MaxRegression, test.opts.CompareMode)
+}
+
+// saveToHistory appends the finished test to the history file, confirming it
+// on w with --verbose
+func saveToHistory(test *LoadTest, globalOpts *GlobalOptions, w io.Writer) {
 	history, err := loadHistory()
 	if err != nil {
 		if globalOpts.Verbose {
 			fmt.Fprintf(os.Stderr, "Warning: Could not load history: %v\n", err)
 		}
-	} else {
-		if err := history.addEntry(test); err != nil {
-			if globalOpts.Verbose {
-				fmt.Fprintf(os.Stderr, "Warning: Could not save to history: %v\n", err)
-			}
-		} else if globalOpts.Verbose {
-			fmt.Printf("Test results saved to history.\n")
+		return
+	}
+	if err := history.addEntry(test); err != nil {
+		if globalOpts.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: Could not save to history: %v\n", err)
 		}
+	} else if globalOpts.Verbose {
+		fmt.Fprintf(w, "Test results saved to history.\n")
 	}
 }
 
@@ -193,45 +646,101 @@ func runConfig(opts *ConfigOptions, globalOpts *GlobalOptions) {
 }
 
 func runHistory(opts *HistoryOptions, globalOpts *GlobalOptions) {
+	if err := validateHistoryOptions(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
 	history, err := loadHistory()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading history: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 
 	if opts.Clear {
 		if err := history.clearHistory(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error clearing history: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitFailure)
 		}
 		fmt.Println("Test history cleared successfully.")
 		return
 	}
 
+	if opts.Prune {
+		// Checked by validateHistoryOptions
+		policy, _ := parseRetention(opts.Retention)
+		removed := history.prune(policy, time.Now())
+		if err := history.saveHistory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving history: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		fmt.Printf("Pruned %d entries; %d remain.\n", removed, len(history.Entries))
+		return
+	}
+
+	if opts.ShowEntry != 0 {
+		if err := history.printEntry(opts.ShowEntry); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	// Narrow the listing to runs of one configuration
+	if opts.Config != "" {
+		history = history.withConfigHash(opts.Config)
+	}
+
+	if opts.Export != "" {
+		if err := exportHistory(history, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
 	// Show history by default if no other action is specified
-	if opts.Show || (!opts.Clear) {
+	if opts.Table {
+		history.printHistoryTable(opts.Limit)
+	} else if opts.Show || (!opts.Clear) {
 		history.printHistory(opts.Limit)
 	}
 }
 
+// exportHistory writes the history in the --export format to --file, or to
+// stdout when no file is given
+func exportHistory(history *TestHistory, opts *HistoryOptions) error {
+	w := io.Writer(os.Stdout)
+	if opts.File != "" {
+		file, err := os.Create(opts.File)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", opts.File, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if opts.Export == "csv" {
+		return history.exportCSV(w, opts.Limit)
+	}
+	return history.exportJSONLines(w, opts.Limit)
+}
+
 func runVisualize(opts *VisualizeOptions, globalOpts *GlobalOptions) {
+	if err := validateVisualizeOptions(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
 	history, err := loadHistory()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading history: %v\n", err)
-		os.Exit(1)
-	}
-
-	validMetrics := map[string]bool{
-		"success-rate":     true,
-		"requests-per-sec": true,
-		"avg-latency":      true,
-		"throughput":       true,
+		os.Exit(exitFailure)
 	}
 
-	if !validMetrics[opts.Metric] {
-		fmt.Fprintf(os.Stderr, "Invalid metric: %s. Valid options: success-rate, requests-per-sec, avg-latency, throughput\n", opts.Metric)
-		os.Exit(1)
+	if opts.Config != "" {
+		history = history.withConfigHash(opts.Config)
 	}
 
-	history.generateComparisonChart(opts.Metric, opts.Limit)
+	history.generateComparisonChart(opts.Metric, opts.Limit, opts.GroupBy, opts.XAxis)
 }
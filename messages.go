@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// corpusMessage is one entry of --messages-file
+type corpusMessage struct {
+	label   string
+	payload []byte
+}
+
+// loadMessagesFile reads the messages to cycle through, one per line. A line
+// of the form "label<TAB>message" names its message type; other messages are
+// labelled by line number. Blank lines and lines starting with '#' are skipped.
+// With decodeBase64 each message is base64-decoded, as for --message-encoding;
+// with strictJSON every message must be valid JSON.
+func loadMessagesFile(path string, decodeBase64, strictJSON bool) ([]corpusMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages file: %v", err)
+	}
+	defer file.Close()
+
+	var messages []corpusMessage
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		label, message := fmt.Sprintf("line %d", lineNo), line
+		if name, rest, ok := strings.Cut(line, "\t"); ok && name != "" {
+			label, message = name, rest
+		}
+
+		payload := []byte(message)
+		if decodeBase64 {
+			if payload, err = base64.StdEncoding.DecodeString(strings.TrimSpace(message)); err != nil {
+				return nil, fmt.Errorf("messages file line %d is not valid base64: %v", lineNo, err)
+			}
+		}
+		if strictJSON && !isValidJSON(string(payload)) {
+			return nil, fmt.Errorf("messages file line %d is not valid JSON (--strict-json)", lineNo)
+		}
+		messages = append(messages, corpusMessage{label: label, payload: payload})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages file: %v", err)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages file %s contains no messages", path)
+	}
+	return messages, nil
+}
+
+// messageIndex returns which --messages-file entry the message with sequence
+// number seq carries; messages are sent in file order, cycling
+func (lt *LoadTest) messageIndex(seq uint64) int {
+	return int((seq - 1) % uint64(len(lt.messages)))
+}
+
+// recordMessageLatencyLocked files the latency of a successful request under
+// its --messages-file entry; results.mu must be held
+func (lt *LoadTest) recordMessageLatencyLocked(seq uint64, latency time.Duration) {
+	if lt.messages == nil {
+		return
+	}
+	i := lt.messageIndex(seq)
+	lt.results.MessageLatencies[i] = append(lt.results.MessageLatencies[i], latency)
+}
+
+// printMessageLatencies breaks the latency down by --messages-file entry so
+// slow message types stand out in a mixed workload; results.mu must be held
+func (lt *LoadTest) printMessageLatencies() {
+	unit := lt.opts.LatencyUnit
+	labelWidth := len("Message")
+	for _, msg := range lt.messages {
+		labelWidth = max(labelWidth, len(msg.label))
+	}
+
+	// The slowest type is the one with the highest top percentile
+	top := lt.opts.Percentiles[len(lt.opts.Percentiles)-1]
+	slowest, slowestValue := -1, time.Duration(0)
+	for i, latencies := range lt.results.MessageLatencies {
+		if len(latencies) == 0 {
+			continue
+		}
+		if value := calculatePercentile(append([]time.Duration(nil), latencies...), top); value > slowestValue {
+			slowest, slowestValue = i, value
+		}
+	}
+
+	fmt.Printf("Latency by Message:\n")
+	fmt.Printf("  %-*s %10s %12s", labelWidth, "Message", "Requests", "Avg")
+	for _, p := range lt.opts.Percentiles {
+		fmt.Printf(" %12s", percentileLabel(p))
+	}
+	fmt.Printf("\n")
+
+	for i, msg := range lt.messages {
+		latencies := append([]time.Duration(nil), lt.results.MessageLatencies[i]...)
+		fmt.Printf("  %-*s %10d", labelWidth, msg.label, len(latencies))
+		if len(latencies) == 0 {
+			fmt.Printf(" %12s\n", "-")
+			continue
+		}
+
+		var total time.Duration
+		for _, latency := range latencies {
+			total += latency
+		}
+		fmt.Printf(" %12s", formatLatency(total/time.Duration(len(latencies)), unit))
+		for _, p := range lt.opts.Percentiles {
+			fmt.Printf(" %12s", formatLatency(calculatePercentile(latencies, p), unit))
+		}
+		if i == slowest && len(lt.messages) > 1 {
+			fmt.Printf("  ← slowest")
+		}
+		fmt.Printf("\n")
+	}
+	fmt.Printf("\n")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// commandPrefetch is how many generated payloads are buffered ahead of
+	// the send loop
+	commandPrefetch = 1024
+
+	// maxCommandPayload is the longest line accepted from --message-command
+	maxCommandPayload = 16 << 20
+)
+
+// commandGenerator runs --message-command once and streams payloads from its
+// stdout, one per line. Payloads are read ahead into a buffer so a generator
+// that is occasionally slow does not stall the send loop.
+type commandGenerator struct {
+	cmd      *exec.Cmd
+	stderr   bytes.Buffer
+	payloads chan []byte
+	done     chan struct{}
+	base64   bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// startCommandGenerator starts command through the system shell; with
+// decodeBase64 each line is base64-decoded into a binary payload
+func startCommandGenerator(command string, decodeBase64 bool) (*commandGenerator, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	g := &commandGenerator{
+		cmd:      cmd,
+		payloads: make(chan []byte, commandPrefetch),
+		done:     make(chan struct{}),
+		base64:   decodeBase64,
+	}
+	cmd.Stderr = &g.stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start message command: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start message command: %v", err)
+	}
+
+	go func() {
+		defer close(g.done)
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxCommandPayload)
+		for scanner.Scan() {
+			payload := append([]byte(nil), scanner.Bytes()...)
+			if g.base64 {
+				decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(payload)))
+				if err != nil {
+					g.fail(fmt.Errorf("message command output is not valid base64: %v", err))
+					continue
+				}
+				payload = decoded
+			}
+			g.payloads <- payload
+		}
+		scanErr := scanner.Err()
+
+		// The command has closed stdout: report why it stopped producing
+		waitErr := cmd.Wait()
+		switch {
+		case scanErr != nil:
+			g.fail(fmt.Errorf("failed to read message command output: %v", scanErr))
+		case waitErr != nil:
+			if stderr := strings.TrimSpace(g.stderr.String()); stderr != "" {
+				waitErr = fmt.Errorf("%v: %s", waitErr, stderr)
+			}
+			g.fail(fmt.Errorf("message command failed: %v", waitErr))
+		default:
+			g.fail(fmt.Errorf("message command exited"))
+		}
+	}()
+
+	return g, nil
+}
+
+// fail records the first generator failure
+func (g *commandGenerator) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// next returns the next payload, waiting at most timeout for the command to
+// produce one
+func (g *commandGenerator) next(timeout time.Duration) ([]byte, error) {
+	select {
+	case payload := <-g.payloads:
+		return payload, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case payload := <-g.payloads:
+		return payload, nil
+	case <-g.done:
+		// Payloads buffered before the command stopped are still valid
+		select {
+		case payload := <-g.payloads:
+			return payload, nil
+		default:
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return nil, g.err
+	case <-timer.C:
+		return nil, fmt.Errorf("message command produced no payload within %s", timeout)
+	}
+}
+
+// stop terminates the command if it is still running
+func (g *commandGenerator) stop() {
+	select {
+	case <-g.done:
+		return
+	default:
+	}
+	if g.cmd.Process != nil {
+		g.cmd.Process.Kill()
+	}
+	// Unblock the reader if it is waiting on a full buffer; give up if a
+	// child process of the shell keeps stdout open
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case <-g.payloads:
+		case <-g.done:
+			return
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseInterval is a stretch of the test during which sending was paused,
+// as offsets from the test start; an open interval has a zero End
+type pauseInterval struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// pauseGate holds back every connection's sends while the test is paused,
+// without closing any connection
+type pauseGate struct {
+	mu        sync.Mutex
+	start     time.Time
+	resumed   chan struct{} // nil while sending, closed on resume
+	intervals []pauseInterval
+}
+
+// newPauseGate creates an open gate for a test that started at start
+func newPauseGate(start time.Time) *pauseGate {
+	return &pauseGate{start: start}
+}
+
+// pause stops sends until resume; it reports false if already paused
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	g.intervals = append(g.intervals, pauseInterval{Start: time.Since(g.start)})
+	return true
+}
+
+// resume lets sends continue; it reports false if not paused
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	g.intervals[len(g.intervals)-1].End = time.Since(g.start)
+	return true
+}
+
+// wait blocks while the test is paused, until it resumes or done is closed.
+// A nil gate never pauses.
+func (g *pauseGate) wait(done <-chan struct{}) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-done:
+		}
+	}
+}
+
+// toggle pauses a running test or resumes a paused one, noting it on stderr
+func (g *pauseGate) toggle(pause bool, source string) {
+	switch {
+	case pause && g.pause():
+		fmt.Fprintf(os.Stderr, "\nPaused sending (%s); connections stay open\n", source)
+	case !pause && g.resume():
+		fmt.Fprintf(os.Stderr, "\nResumed sending (%s)\n", source)
+	}
+}
+
+// summary lists the paused intervals up to end, e.g. "+3.0s–+8.2s (5.2s)",
+// closing one still open when the test ended
+func (g *pauseGate) summary(end time.Duration) (string, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	parts := make([]string, 0, len(g.intervals))
+	var total time.Duration
+	for _, interval := range g.intervals {
+		if interval.End == 0 {
+			interval.End = end
+		}
+		length := interval.End - interval.Start
+		total += length
+		parts = append(parts, fmt.Sprintf("+%.1fs–+%.1fs (%.1fs)", interval.Start.Seconds(), interval.End.Seconds(), length.Seconds()))
+	}
+	return strings.Join(parts, ", "), total
+}
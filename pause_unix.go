@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals pauses sending on SIGUSR1 and resumes it on SIGUSR2
+// until the test ends
+func (lt *LoadTest) watchPauseSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGUSR1 {
+				lt.pause.toggle(true, "SIGUSR1")
+			} else {
+				lt.pause.toggle(false, "SIGUSR2")
+			}
+		case <-lt.ctx.Done():
+			return
+		}
+	}
+}
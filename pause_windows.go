@@ -0,0 +1,6 @@
+//go:build windows
+
+package main
+
+// watchPauseSignals does nothing on Windows, which has no SIGUSR1/SIGUSR2
+func (lt *LoadTest) watchPauseSignals() {}
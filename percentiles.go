@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PercentileList is the value of --percentiles: latency percentiles to
+// report, e.g. "50,90,99,99.9"
+type PercentileList []float64
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (l *PercentileList) UnmarshalFlag(value string) error {
+	var percentiles PercentileList
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(field)), "P")
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentile %q in %q (use values between 0 and 100, e.g. 50,95,99.9)", field, value)
+		}
+		percentiles = append(percentiles, p)
+	}
+	*l = percentiles
+	return nil
+}
+
+// percentileLabel formats a percentile as "P50" or "P99.9"
+func percentileLabel(p float64) string {
+	return "P" + strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// redacted replaces sensitive values in --print-config output
+const redacted = "REDACTED"
+
+// sensitiveQueryParams are URL query parameters that carry credentials
+var sensitiveQueryParams = map[string]bool{
+	"access_token":         true,
+	"token":                true,
+	"api_key":              true,
+	"apikey":               true,
+	"key":                  true,
+	"password":             true,
+	"sig":                  true,
+	"signature":            true,
+	"x-amz-credential":     true,
+	"x-amz-security-token": true,
+	"x-amz-signature":      true,
+}
+
+// sensitiveHeaders are request headers that carry credentials
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// effectiveConfig is the fully resolved test configuration shown by
+// --print-config
+type effectiveConfig struct {
+	URL                string            `json:"url"`
+	Duration           string            `json:"duration"`
+	Connections        int               `json:"connections"`
+	Loop               int               `json:"loop"`
+	Requests           int               `json:"requests,omitempty"`
+	TargetConcurrency  int               `json:"target_concurrency,omitempty"`
+	FrameType          string            `json:"frame_type"`
+	FrameSize          int               `json:"frame_size,omitempty"`
+	Message            string            `json:"message,omitempty"`
+	MessageBytes       int               `json:"message_bytes"`
+	MessageSource      string            `json:"message_source"`
+	FirstMessage       string            `json:"first_message,omitempty"`
+	AwaitFirstResponse bool              `json:"await_first_response,omitempty"`
+	StrictJSON         bool              `json:"strict_json,omitempty"`
+	Subprotocols       []string          `json:"subprotocols,omitempty"`
+	Resolve            map[string]string `json:"resolve,omitempty"`
+	Percentiles        []float64         `json:"percentiles"`
+	LatencyUnit        string            `json:"latency_unit"`
+	HandshakeTimeout   string            `json:"handshake_timeout"`
+	TCPConnectTimeout  string            `json:"tcp_connect_timeout,omitempty"`
+	ReadTimeout        string            `json:"read_timeout,omitempty"`
+	WriteTimeout       string            `json:"write_timeout,omitempty"`
+	ResponseTimeout    string            `json:"response_timeout,omitempty"`
+	IdleTimeout        string            `json:"idle_timeout,omitempty"`
+	DrainTimeout       string            `json:"drain_timeout,omitempty"`
+	RampUp             string            `json:"ramp_up,omitempty"`
+	RampDown           string            `json:"ramp_down,omitempty"`
+	ConnectionLifetime string            `json:"connection_lifetime,omitempty"`
+	MaxBandwidth       string            `json:"max_bandwidth,omitempty"`
+	Rate               float64           `json:"rate_per_connection,omitempty"`
+	Thresholds         map[string]string `json:"thresholds,omitempty"`
+	MetricsFile        string            `json:"metrics_file,omitempty"`
+	HdrExport          string            `json:"hdr_export,omitempty"`
+	CSVLatencies       string            `json:"csv_latencies,omitempty"`
+	RemoteWrite        string            `json:"remote_write,omitempty"`
+	RemoteWriteHeaders []string          `json:"remote_write_headers,omitempty"`
+	History            string            `json:"history"`
+}
+
+// resolveEffectiveConfig builds the configuration a run with opts would use.
+// opts must already have passed validateTestOptions.
+func resolveEffectiveConfig(opts *TestOptions) (effectiveConfig, error) {
+	normalized, err := validateWebSocketURL(opts.URL)
+	if err != nil {
+		return effectiveConfig{}, err
+	}
+
+	cfg := effectiveConfig{
+		URL:                redactURL(normalized),
+		Duration:           opts.Duration,
+		Connections:        int(opts.Connections),
+		Loop:               opts.Loop,
+		Requests:           opts.Requests,
+		TargetConcurrency:  opts.TargetConcurrency,
+		FrameType:          "text",
+		FrameSize:          opts.FrameSize,
+		FirstMessage:       opts.FirstMessage,
+		AwaitFirstResponse: opts.AwaitFirstResponse,
+		StrictJSON:         opts.StrictJSON,
+		Subprotocols:       opts.Subprotocols,
+		Percentiles:        opts.Percentiles,
+		LatencyUnit:        opts.LatencyUnit,
+		HandshakeTimeout:   opts.HandshakeTimeout.String(),
+		MetricsFile:        opts.MetricsFile,
+		HdrExport:          opts.HdrExport,
+		CSVLatencies:       opts.CSVLatencies,
+		History:            getHistoryFilePath(),
+	}
+	if binaryFrames(opts) {
+		cfg.FrameType = "binary"
+	}
+	if opts.NoHistory {
+		cfg.History = "disabled"
+	}
+
+	// Show the message as it will be sent: a rendered template sample, a
+	// size distribution, or the (decoded) --message
+	switch {
+	case opts.Fuzz:
+		cfg.MessageSource = "fuzz corpus"
+	case opts.MessageCommand != "":
+		cfg.MessageSource = "command " + opts.MessageCommand
+	case opts.MessagesFile != "":
+		cfg.MessageSource = "messages file " + opts.MessagesFile
+	case opts.MessageFile != "":
+		cfg.MessageSource = "message file " + opts.MessageFile
+		cfg.MessageBytes = len(opts.messageFile)
+	case opts.SizeDist != "":
+		cfg.MessageSource = "size distribution " + opts.SizeDist
+	case opts.JSONTemplate != "":
+		tmpl, err := compileMessageTemplate(opts.JSONTemplate)
+		if err != nil {
+			return effectiveConfig{}, err
+		}
+		sample, err := renderMessageTemplate(tmpl, messageTemplateData{Seq: 1})
+		if err != nil {
+			return effectiveConfig{}, err
+		}
+		cfg.MessageSource = "json template (sample)"
+		cfg.Message = string(sample)
+		cfg.MessageBytes = len(sample)
+	default:
+		message, err := decodeMessage(opts)
+		if err != nil {
+			return effectiveConfig{}, err
+		}
+		cfg.MessageSource = "message (" + opts.MessageEncoding + ")"
+		cfg.Message = opts.Message
+		cfg.MessageBytes = len(message)
+	}
+
+	if len(opts.Resolve) > 0 {
+		if cfg.Resolve, err = parseResolveOverrides(opts.Resolve); err != nil {
+			return effectiveConfig{}, err
+		}
+	}
+
+	if opts.TCPConnectTimeout > 0 {
+		cfg.TCPConnectTimeout = opts.TCPConnectTimeout.String()
+	}
+	if opts.ReadTimeout > 0 {
+		cfg.ReadTimeout = opts.ReadTimeout.String()
+	}
+	if opts.WriteTimeout > 0 {
+		cfg.WriteTimeout = opts.WriteTimeout.String()
+	}
+	if opts.ResponseTimeout > 0 {
+		cfg.ResponseTimeout = opts.ResponseTimeout.String()
+	}
+	if opts.IdleTimeout > 0 {
+		cfg.IdleTimeout = opts.IdleTimeout.String()
+	}
+	if opts.DrainTimeout > 0 {
+		cfg.DrainTimeout = opts.DrainTimeout.String()
+	}
+	if opts.RampUp > 0 {
+		cfg.RampUp = opts.RampUp.String()
+	}
+	if opts.RampDown > 0 {
+		cfg.RampDown = opts.RampDown.String()
+	}
+	if opts.ConnectionLifetime > 0 {
+		cfg.ConnectionLifetime = opts.ConnectionLifetime.String()
+	}
+	if opts.MaxBandwidth > 0 {
+		cfg.MaxBandwidth = formatBytes(int64(opts.MaxBandwidth)) + "/s"
+	}
+	cfg.Rate = opts.Rate
+
+	thresholds := make(map[string]string)
+	if opts.MaxRPSCoV > 0 {
+		thresholds["max_rps_cov"] = fmt.Sprintf("%g", opts.MaxRPSCoV)
+	}
+	if opts.FailOnAnyError {
+		thresholds["fail_on_any_error"] = "true"
+	}
+	if opts.SLOAvailability > 0 {
+		thresholds["slo_availability"] = fmt.Sprintf("%g%%", opts.SLOAvailability)
+	}
+	if opts.BaselineAuto {
+		thresholds["baseline_auto_max_regression"] = fmt.Sprintf("%g%%", opts.MaxRegression)
+	}
+	if len(thresholds) > 0 {
+		cfg.Thresholds = thresholds
+	}
+
+	if opts.RemoteWrite != "" {
+		cfg.RemoteWrite = redactURL(opts.RemoteWrite)
+		for _, header := range opts.RemoteWriteHeaders {
+			cfg.RemoteWriteHeaders = append(cfg.RemoteWriteHeaders, redactHeader(header))
+		}
+	}
+
+	return cfg, nil
+}
+
+// configHash returns a short, stable hash of the workload opts describes, so
+// history can tell comparable runs apart from one-off parameter variations.
+// Settings that only affect reporting (percentiles, latency unit, thresholds,
+// metrics export and history) are left out, as are redacted credentials, so
+// rotating a token does not start a new series. A --json-template is hashed as
+// written, not as the rendered sample, whose {{uuid}} and {{now}} values
+// change on every run. opts must already have passed
+// validateTestOptions; an empty string means the hash could not be computed.
+func configHash(opts *TestOptions) string {
+	cfg, err := resolveEffectiveConfig(opts)
+	if err != nil {
+		return ""
+	}
+	cfg.Percentiles = nil
+	cfg.LatencyUnit = ""
+	cfg.Thresholds = nil
+	cfg.MetricsFile = ""
+	cfg.HdrExport = ""
+	cfg.CSVLatencies = ""
+	cfg.RemoteWrite = ""
+	cfg.RemoteWriteHeaders = nil
+	cfg.History = ""
+	if opts.JSONTemplate != "" {
+		cfg.Message = opts.JSONTemplate
+		cfg.MessageBytes = 0
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// printEffectiveConfig prints the resolved configuration as JSON
+func printEffectiveConfig(opts *TestOptions) error {
+	cfg, err := resolveEffectiveConfig(opts)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(cfg)
+}
+
+// redactURL hides the password and credential query parameters of a URL
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if _, hasPassword := parsedURL.User.Password(); hasPassword {
+		parsedURL.User = url.UserPassword(parsedURL.User.Username(), redacted)
+	}
+	query := parsedURL.Query()
+	changed := false
+	for name := range query {
+		if sensitiveQueryParams[strings.ToLower(name)] {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		parsedURL.RawQuery = query.Encode()
+	}
+	return parsedURL.String()
+}
+
+// redactHeader hides the value of a "Name: value" header carrying credentials
+func redactHeader(header string) string {
+	name, _, ok := strings.Cut(header, ":")
+	if ok && sensitiveHeaders[strings.ToLower(strings.TrimSpace(name))] {
+		return strings.TrimSpace(name) + ": " + redacted
+	}
+	return header
+}
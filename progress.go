@@ -0,0 +1,80 @@
+package main
+
+import (
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// progressInterval is how often the progress bar is redrawn
+const progressInterval = 100 * time.Millisecond
+
+// progressDescription labels the progress bar, saying whether --ramp-up is
+// still opening connections
+func progressDescription(rampingUp, steady bool) string {
+	switch {
+	case rampingUp:
+		return "[cyan][1/3][reset] Running WebSocket load test (ramping up)..."
+	case steady:
+		return "[cyan][1/3][reset] Running WebSocket load test (steady state)..."
+	}
+	return "[cyan][1/3][reset] Running WebSocket load test..."
+}
+
+// startProgress draws the progress bar for a test of the given duration that
+// started at lt.results.StartTime, and returns a function that completes it;
+// an aborted test leaves the bar where it stopped.
+// A single goroutine owns the bar: connections never touch it, so it cannot
+// race with its own redraws or with Finish. It advances with elapsed time,
+// as the bar is sized in milliseconds of the test.
+func (lt *LoadTest) startProgress(duration time.Duration) (stop func()) {
+	total := duration.Milliseconds()
+	rampingUp := lt.opts.RampUp > 0
+
+	lt.progress = progressbar.NewOptions64(
+		total,
+		progressbar.OptionSetWriter(lt.progressWriter()),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionSetDescription(progressDescription(rampingUp, false)),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+	)
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				if lt.abortReason != "" {
+					lt.progress.Exit()
+				} else {
+					lt.progress.Finish()
+				}
+				return
+			}
+			if rampingUp && lt.rampedUp.Load() {
+				rampingUp = false
+				lt.progress.Describe(progressDescription(false, true))
+			}
+			lt.progress.Set64(min(time.Since(lt.results.StartTime).Milliseconds(), total))
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prometheusQuantiles are the latency quantiles written to the metrics file
+var prometheusQuantiles = []int{50, 90, 95, 99}
+
+// escapeLabelValue escapes a Prometheus label value for the text exposition format
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// formatPrometheusMetrics renders the final test results in the Prometheus
+// text exposition format
+func (lt *LoadTest) formatPrometheusMetrics() string {
+	lt.results.mu.RLock()
+	defer lt.results.mu.RUnlock()
+
+	duration := lt.results.EndTime.Sub(lt.results.StartTime).Seconds()
+	labels := fmt.Sprintf(`url="%s"`, escapeLabelValue(lt.opts.URL))
+
+	var b strings.Builder
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, kind)
+		fmt.Fprintf(&b, "%s{%s} %g\n", name, labels, value)
+	}
+
+	metric("wsload_test_duration_seconds", "gauge", "Wall-clock duration of the test run.", duration)
+	metric("wsload_connections", "gauge", "Number of concurrent connections configured.", float64(lt.opts.Connections))
+	metric("wsload_requests_total", "counter", "Total requests attempted.", float64(lt.results.TotalRequests))
+	metric("wsload_requests_successful_total", "counter", "Requests that completed successfully.", float64(lt.results.SuccessfulReqs))
+	metric("wsload_requests_failed_total", "counter", "Requests that failed.", float64(lt.results.FailedReqs))
+	var rps, throughput float64
+	if duration > 0 {
+		rps = float64(lt.results.TotalRequests) / duration
+		throughput = float64(lt.results.BytesSent+lt.results.BytesReceived) / duration
+	}
+	metric("wsload_requests_per_second", "gauge", "Average request rate over the test.", rps)
+	metric("wsload_throughput_bytes_per_second", "gauge", "Average bytes sent and received per second.", throughput)
+	metric("wsload_bytes_sent_total", "counter", "Total payload bytes sent.", float64(lt.results.BytesSent))
+	metric("wsload_bytes_received_total", "counter", "Total payload bytes received.", float64(lt.results.BytesReceived))
+	metric("wsload_messages_received_total", "counter", "Total messages received, including server pushes.", float64(lt.results.MessagesReceived))
+	metric("wsload_peak_latency_seconds", "gauge", "Highest latency observed.", lt.results.PeakResponseTime.Seconds())
+
+	// Latency summary
+	quantiles := make([]float64, len(prometheusQuantiles))
+	for i, q := range prometheusQuantiles {
+		quantiles[i] = float64(q)
+	}
+	fmt.Fprintf(&b, "# HELP wsload_latency_seconds Request latency.\n")
+	fmt.Fprintf(&b, "# TYPE wsload_latency_seconds summary\n")
+	for i, latency := range lt.latencyPercentiles(quantiles) {
+		fmt.Fprintf(&b, "wsload_latency_seconds{%s,quantile=\"%g\"} %g\n",
+			labels, quantiles[i]/100, latency.Seconds())
+	}
+	fmt.Fprintf(&b, "wsload_latency_seconds_sum{%s} %g\n", labels, lt.results.TotalLatency.Seconds())
+	fmt.Fprintf(&b, "wsload_latency_seconds_count{%s} %d\n", labels, lt.results.RoundTrips)
+
+	// Error counts by category, in a stable order
+	categories := lt.results.sortedErrorCategories()
+	fmt.Fprintf(&b, "# HELP wsload_errors_total Errors by category.\n")
+	fmt.Fprintf(&b, "# TYPE wsload_errors_total counter\n")
+	for _, category := range categories {
+		fmt.Fprintf(&b, "wsload_errors_total{%s,category=\"%s\"} %d\n",
+			labels, category, lt.results.ErrorCategories[category].Count)
+	}
+
+	return b.String()
+}
+
+// writeMetricsFile writes the final results to path in the Prometheus text
+// format. The file is written to a temporary name and renamed into place so a
+// textfile collector never reads a partial file.
+func (lt *LoadTest) writeMetricsFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ws-load-metrics-*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(lt.formatPrometheusMetrics()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// remoteWriteInterval is how often buffered samples are pushed to the
+// remote-write endpoint while a test runs
+const remoteWriteInterval = 10 * time.Second
+
+// promLabel is a Prometheus label pair
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+// promSample is a single value at a millisecond timestamp
+type promSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// promSeries is one time series in a remote-write request
+type promSeries struct {
+	Labels  []promLabel
+	Samples []promSample
+}
+
+// remoteWriter buffers per-second samples and pushes them to a Prometheus
+// remote-write endpoint (Cortex, Mimir, Thanos receive, ...)
+type remoteWriter struct {
+	url     string
+	headers http.Header
+	client  *http.Client
+
+	mu     sync.Mutex
+	series map[string]*promSeries
+}
+
+// newRemoteWriter creates a writer for endpoint; headers are "Name: value"
+// strings, typically used for authorization
+func newRemoteWriter(endpoint string, headers []string) (*remoteWriter, error) {
+	parsedURL, err := url.Parse(endpoint)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid --remote-write URL %q (use http:// or https://)", endpoint)
+	}
+
+	header := http.Header{}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --remote-write-header %q (use \"Name: value\")", h)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	return &remoteWriter{
+		url:     endpoint,
+		headers: header,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		series:  make(map[string]*promSeries),
+	}, nil
+}
+
+// add buffers a sample for the metric name with the given labels
+func (w *remoteWriter) add(name string, labels []promLabel, value float64, at time.Time) {
+	all := append([]promLabel{{Name: "__name__", Value: name}}, labels...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	var key strings.Builder
+	for _, label := range all {
+		key.WriteString(label.Name)
+		key.WriteByte(0)
+		key.WriteString(label.Value)
+		key.WriteByte(0)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	series, ok := w.series[key.String()]
+	if !ok {
+		series = &promSeries{Labels: all}
+		w.series[key.String()] = series
+	}
+	series.Samples = append(series.Samples, promSample{Value: value, Timestamp: at.UnixMilli()})
+}
+
+// flush pushes all buffered samples. Samples are dropped once sent, or once a
+// push has failed, so a down endpoint cannot grow the buffer without bound.
+func (w *remoteWriter) flush() error {
+	w.mu.Lock()
+	series := make([]promSeries, 0, len(w.series))
+	for _, s := range w.series {
+		series = append(series, *s)
+	}
+	w.series = make(map[string]*promSeries)
+	w.mu.Unlock()
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("remote write failed: %v", err)
+	}
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "ws-load")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("remote write failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest protobuf
+// message. The schema is small enough to encode by hand:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []promSeries) []byte {
+	var request []byte
+	for _, s := range series {
+		var ts []byte
+		for _, label := range s.Labels {
+			var l []byte
+			l = appendProtoBytes(l, 1, []byte(label.Name))
+			l = appendProtoBytes(l, 2, []byte(label.Value))
+			ts = appendProtoBytes(ts, 1, l)
+		}
+		for _, sample := range s.Samples {
+			var sm []byte
+			sm = appendProtoKey(sm, 1, 1)
+			sm = binary.LittleEndian.AppendUint64(sm, math.Float64bits(sample.Value))
+			sm = appendProtoKey(sm, 2, 0)
+			sm = binary.AppendUvarint(sm, uint64(sample.Timestamp))
+			ts = appendProtoBytes(ts, 2, sm)
+		}
+		request = appendProtoBytes(request, 1, ts)
+	}
+	return request
+}
+
+// appendProtoKey appends a protobuf field key
+func appendProtoKey(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+// appendProtoBytes appends a length-delimited protobuf field
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendProtoKey(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Size of the inline SVG charts in the HTML report, in pixels
+	reportChartWidth  = 720
+	reportChartHeight = 220
+	reportChartMargin = 40
+)
+
+// reportMetric is one labelled value in the HTML report's metrics table
+type reportMetric struct {
+	Name  string
+	Value string
+}
+
+// reportError is one error category in the HTML report's breakdown
+type reportError struct {
+	Category string
+	Count    int
+	Share    float64
+}
+
+// htmlReportData is everything the HTML report template renders
+type htmlReportData struct {
+	URL         string
+	Generated   string
+	AbortReason string
+	Metrics     []reportMetric
+	Latency     template.HTML
+	Timeline    template.HTML
+	Errors      []reportError
+	Config      string
+}
+
+// writeHTMLReport writes the results of a finished test as a single
+// self-contained HTML page for --output html: metrics, inline SVG charts, the
+// error breakdown and the effective configuration, with no external assets
+func (lt *LoadTest) writeHTMLReport(w io.Writer) error {
+	summary := lt.Results()
+	unit := lt.opts.LatencyUnit
+
+	data := htmlReportData{
+		URL:         redactURL(lt.opts.URL),
+		Generated:   summary.EndTime.Format(time.RFC1123),
+		AbortReason: summary.AbortReason,
+		Metrics: []reportMetric{
+			{"Duration", summary.Duration.Round(time.Millisecond).String()},
+			{"Connections", fmt.Sprintf("%d established of %d", summary.EstablishedConns, lt.opts.Connections)},
+			{"Total Requests", fmt.Sprintf("%d", summary.TotalRequests)},
+			{"Successful", fmt.Sprintf("%d (%.1f%%)", summary.SuccessfulReqs, summary.SuccessRate)},
+			{"Failed", fmt.Sprintf("%d", summary.FailedReqs)},
+			{"Requests/sec", fmt.Sprintf("%.2f", summary.RequestsPerSec)},
+			{"Avg Latency", formatLatency(summary.AvgLatency, unit)},
+			{"Peak Latency", formatLatency(summary.PeakLatency, unit)},
+			{"Throughput", formatBytes(int64(summary.Throughput)) + "/s"},
+			{"Bytes Sent", formatBytes(summary.BytesSent)},
+			{"Bytes Received", formatBytes(summary.BytesReceived)},
+		},
+	}
+
+	// Percentiles in the order they were requested
+	labels := make([]string, 0, len(lt.opts.Percentiles))
+	values := make([]float64, 0, len(lt.opts.Percentiles))
+	for _, p := range lt.opts.Percentiles {
+		label := percentileLabel(p)
+		latency := summary.Percentiles[label]
+		data.Metrics = append(data.Metrics, reportMetric{label + " Latency", formatLatency(latency, unit)})
+		labels = append(labels, label)
+		values = append(values, float64(latency)/float64(time.Millisecond))
+	}
+	if summary.SuccessfulReqs > 0 {
+		data.Latency = svgBarChart(labels, values, "ms")
+	}
+
+	lt.results.mu.RLock()
+	data.Timeline = svgTimeline(lt.results.Timeline)
+	lt.results.mu.RUnlock()
+
+	for category, count := range summary.ErrorCategories {
+		share := 0.0
+		if summary.FailedReqs > 0 {
+			share = float64(count) / float64(summary.FailedReqs) * 100
+		}
+		data.Errors = append(data.Errors, reportError{Category: category, Count: count, Share: share})
+	}
+	sort.Slice(data.Errors, func(i, j int) bool {
+		if data.Errors[i].Count != data.Errors[j].Count {
+			return data.Errors[i].Count > data.Errors[j].Count
+		}
+		return data.Errors[i].Category < data.Errors[j].Category
+	})
+
+	cfg, err := resolveEffectiveConfig(lt.opts)
+	if err != nil {
+		return err
+	}
+	config, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	data.Config = string(config)
+
+	return htmlReportTemplate.Execute(w, data)
+}
+
+// svgBarChart renders one labelled bar per value as an inline SVG
+func svgBarChart(labels []string, values []float64, unit string) template.HTML {
+	if len(values) == 0 {
+		return ""
+	}
+	maxValue := 0.0
+	for _, v := range values {
+		maxValue = max(maxValue, v)
+	}
+	if maxValue == 0 {
+		maxValue = 1
+	}
+
+	plotWidth := float64(reportChartWidth - 2*reportChartMargin)
+	plotHeight := float64(reportChartHeight - 2*reportChartMargin)
+	slot := plotWidth / float64(len(values))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		reportChartWidth, reportChartHeight, reportChartWidth, reportChartHeight)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`,
+		reportChartMargin, reportChartHeight-reportChartMargin, reportChartWidth-reportChartMargin, reportChartHeight-reportChartMargin)
+	for i, v := range values {
+		height := v / maxValue * plotHeight
+		x := float64(reportChartMargin) + float64(i)*slot + slot*0.15
+		y := float64(reportChartHeight-reportChartMargin) - height
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" class="bar"><title>%s: %.3f%s</title></rect>`,
+			x, y, slot*0.7, height, template.HTMLEscapeString(labels[i]), v, unit)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" class="value">%.3f%s</text>`, x+slot*0.35, y-4, v, unit)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="label">%s</text>`,
+			x+slot*0.35, reportChartHeight-reportChartMargin+16, template.HTMLEscapeString(labels[i]))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// svgTimeline renders the successful and failed requests completed in each
+// second of the test as stacked bars in an inline SVG
+func svgTimeline(timeline []timelinePoint) template.HTML {
+	if len(timeline) == 0 {
+		return ""
+	}
+
+	successful := make([]int64, len(timeline))
+	failed := make([]int64, len(timeline))
+	var previous timelinePoint
+	peak := int64(1)
+	for i, point := range timeline {
+		successful[i] = point.Successful - previous.Successful
+		failed[i] = point.Failed - previous.Failed
+		previous = point
+		peak = max(peak, successful[i]+failed[i])
+	}
+
+	plotWidth := float64(reportChartWidth - 2*reportChartMargin)
+	plotHeight := float64(reportChartHeight - 2*reportChartMargin)
+	slot := plotWidth / float64(len(timeline))
+	base := float64(reportChartHeight - reportChartMargin)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		reportChartWidth, reportChartHeight, reportChartWidth, reportChartHeight)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="axis"/>`,
+		reportChartMargin, base, reportChartWidth-reportChartMargin, base)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" class="label">%d req/s</text>`, reportChartMargin, reportChartMargin-8, peak)
+	for i := range timeline {
+		x := float64(reportChartMargin) + float64(i)*slot
+		okHeight := float64(successful[i]) / float64(peak) * plotHeight
+		failHeight := float64(failed[i]) / float64(peak) * plotHeight
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" class="ok"><title>%ds: %d successful</title></rect>`,
+			x, base-okHeight, max(slot-1, 0.5), okHeight, i+1, successful[i])
+		if failed[i] > 0 {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" class="fail"><title>%ds: %d failed</title></rect>`,
+				x, base-okHeight-failHeight, max(slot-1, 0.5), failHeight, i+1, failed[i])
+		}
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="label">%ds</text>`, reportChartWidth-reportChartMargin, base+16, len(timeline))
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>WebSocket Load Test Report - {{.URL}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 800px; color: #222; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+h2 { font-size: 1.15em; margin-top: 1.8em; border-bottom: 1px solid #ddd; padding-bottom: 0.2em; }
+.meta { color: #666; }
+.abort { background: #fdecea; border: 1px solid #f5c2c0; padding: 0.6em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #eee; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+svg .axis { stroke: #999; }
+svg .bar { fill: #4c78a8; }
+svg .ok { fill: #54a24b; }
+svg .fail { fill: #e45756; }
+svg text { font-size: 11px; fill: #444; }
+svg .label, svg .value { text-anchor: middle; }
+</style>
+</head>
+<body>
+<h1>WebSocket Load Test Report</h1>
+<p class="meta">{{.URL}} &middot; finished {{.Generated}}</p>
+{{if .AbortReason}}<p class="abort">Test aborted: {{.AbortReason}}</p>{{end}}
+
+<h2>Metrics</h2>
+<table>
+{{range .Metrics}}<tr><th>{{.Name}}</th><td class="num">{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Latency Percentiles</h2>
+{{if .Latency}}{{.Latency}}{{else}}<p>No successful requests.</p>{{end}}
+
+<h2>Requests per Second</h2>
+{{if .Timeline}}{{.Timeline}}{{else}}<p>No timeline recorded.</p>{{end}}
+
+<h2>Errors</h2>
+{{if .Errors}}<table>
+<tr><th>Category</th><th>Count</th><th>Share of failures</th></tr>
+{{range .Errors}}<tr><td>{{.Category}}</td><td class="num">{{.Count}}</td><td class="num">{{printf "%.1f%%" .Share}}</td></tr>
+{{end}}</table>{{else}}<p>No errors.</p>{{end}}
+
+<h2>Configuration</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
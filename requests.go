@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// requestQueue hands out the --requests message IDs to whichever connection
+// is ready to send next, so a fixed pool of connections shares a total
+// request count instead of each sending --loop messages
+type requestQueue struct {
+	ids       chan int
+	total     int64
+	completed atomic.Int64
+	finished  chan struct{}
+
+	mu       sync.Mutex
+	returned []int         // Taken but not sent, handed out again first
+	requeued chan struct{} // Signalled when returned gains a request
+}
+
+// newRequestQueue creates a queue of total requests for the given number of
+// connections; the buffer keeps every connection supplied without
+// materializing the whole backlog
+func newRequestQueue(total, connections int) *requestQueue {
+	return &requestQueue{
+		ids:      make(chan int, connections),
+		total:    int64(total),
+		finished: make(chan struct{}),
+		requeued: make(chan struct{}, 1),
+	}
+}
+
+// feed queues the request IDs in order and closes the queue once they are all
+// handed out or the test ends
+func (q *requestQueue) feed(ctx context.Context) {
+	defer close(q.ids)
+	for id := 0; id < int(q.total); id++ {
+		select {
+		case q.ids <- id:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// take returns the next request to send, or false once every request has
+// been sent or done closes. After the last ID is handed out it keeps waiting
+// for requests that closing connections put back, so none is left unsent.
+func (q *requestQueue) take(done <-chan struct{}) (int, bool) {
+	ids := q.ids
+	for {
+		if id, ok := q.takeReturned(); ok {
+			return id, true
+		}
+		select {
+		case id, ok := <-ids:
+			if ok {
+				return id, true
+			}
+			ids = nil
+		case <-q.requeued:
+		case <-q.finished:
+			return 0, false
+		case <-done:
+			return 0, false
+		}
+	}
+}
+
+// takeReturned pops a request that was put back, passing the signal on to
+// another waiting take while more remain
+func (q *requestQueue) takeReturned() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.returned)
+	if n == 0 {
+		return 0, false
+	}
+	id := q.returned[n-1]
+	q.returned = q.returned[:n-1]
+	if n > 1 {
+		q.signalRequeued()
+	}
+	return id, true
+}
+
+// putBack returns a taken request that was not sent, so the next take hands
+// it out again
+func (q *requestQueue) putBack(id int) {
+	q.mu.Lock()
+	q.returned = append(q.returned, id)
+	q.signalRequeued()
+	q.mu.Unlock()
+}
+
+// signalRequeued wakes one waiting take; a pending signal already does
+func (q *requestQueue) signalRequeued() {
+	select {
+	case q.requeued <- struct{}{}:
+	default:
+	}
+}
+
+// done marks one taken request as sent; finished closes after the last one
+func (q *requestQueue) done() {
+	if q.completed.Add(1) == q.total {
+		close(q.finished)
+	}
+}
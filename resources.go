@@ -0,0 +1,54 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// saturatedCPUPercent is the share of all CPUs above which the load generator
+// is reported as saturated
+const saturatedCPUPercent = 90.0
+
+// resourceUsage tracks the load generator's own resource consumption so a
+// client-side bottleneck is not mistaken for a server limit
+type resourceUsage struct {
+	startCPU   time.Duration
+	cpuOK      bool
+	CPUTime    time.Duration
+	CPUPercent float64 // Share of all CPUs, 0-100
+	PeakHeap   uint64  // Peak heap in use, sampled once per second
+	PeakRSS    int64   // Peak resident set size, 0 when unavailable
+}
+
+// start records the CPU time consumed before the test began
+func (r *resourceUsage) start() {
+	r.startCPU, r.cpuOK = processCPUTime()
+	r.sample()
+}
+
+// sample updates the peak heap from the runtime's memory statistics
+func (r *resourceUsage) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapInuse > r.PeakHeap {
+		r.PeakHeap = stats.HeapInuse
+	}
+}
+
+// finish computes CPU utilization over the test's wall-clock duration
+func (r *resourceUsage) finish(wall time.Duration) {
+	r.sample()
+	if cpu, ok := processCPUTime(); ok && r.cpuOK && wall > 0 {
+		r.CPUTime = cpu - r.startCPU
+		r.CPUPercent = r.CPUTime.Seconds() / (wall.Seconds() * float64(runtime.NumCPU())) * 100
+	}
+	if rss, ok := peakRSS(); ok {
+		r.PeakRSS = rss
+	}
+}
+
+// saturated reports whether the generator kept nearly every CPU busy, in which
+// case measured throughput is capped by the client
+func (r *resourceUsage) saturated() bool {
+	return r.CPUPercent >= saturatedCPUPercent
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system CPU time consumed by the process
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
+
+// peakRSS returns the process's maximum resident set size in bytes
+func peakRSS() (int64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	// macOS reports bytes, Linux and the BSDs report kilobytes
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss), true
+	}
+	return int64(usage.Maxrss) * 1024, true
+}
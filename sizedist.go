@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxDistributionSize caps unbounded distributions such as lognormal
+const defaultMaxDistributionSize = 1024 * 1024
+
+// sizeDistribution draws payload sizes from a --size-dist spec and serves
+// payloads of those sizes from a pre-generated filler buffer
+type sizeDistribution struct {
+	kind   string
+	min    int
+	max    int
+	mu     float64
+	sigma  float64
+	lock   sync.Mutex
+	rng    *rand.Rand
+	filler []byte
+}
+
+// parseSizeDistribution parses a spec such as "uniform:100-4096" or
+// "lognormal:mean=512,sigma=1.5[,max=65536]". A zero seed picks a random one.
+func parseSizeDistribution(spec string, seed int64) (*sizeDistribution, error) {
+	kind, params, found := strings.Cut(spec, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid size distribution %q (expected kind:params)", spec)
+	}
+
+	d := &sizeDistribution{kind: kind}
+	switch kind {
+	case "uniform":
+		lo, hi, found := strings.Cut(params, "-")
+		if !found {
+			return nil, fmt.Errorf("invalid uniform distribution %q (expected uniform:min-max)", spec)
+		}
+		var err error
+		if d.min, err = strconv.Atoi(lo); err != nil {
+			return nil, fmt.Errorf("invalid uniform minimum %q", lo)
+		}
+		if d.max, err = strconv.Atoi(hi); err != nil {
+			return nil, fmt.Errorf("invalid uniform maximum %q", hi)
+		}
+		if d.min < 1 || d.max < d.min {
+			return nil, fmt.Errorf("uniform range must satisfy 1 <= min <= max")
+		}
+
+	case "lognormal":
+		mean, sigma := 0.0, 0.0
+		d.min, d.max = 1, defaultMaxDistributionSize
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(param, "=")
+			switch key {
+			case "mean":
+				mean, _ = strconv.ParseFloat(value, 64)
+			case "sigma":
+				sigma, _ = strconv.ParseFloat(value, 64)
+			case "max":
+				d.max, _ = strconv.Atoi(value)
+			default:
+				return nil, fmt.Errorf("unknown lognormal parameter %q", key)
+			}
+		}
+		if mean < 1 || sigma <= 0 || d.max < 1 {
+			return nil, fmt.Errorf("lognormal distribution needs mean >= 1, sigma > 0 and max >= 1")
+		}
+		// Choose the underlying normal's mean so the sizes average to mean
+		d.mu = math.Log(mean) - sigma*sigma/2
+		d.sigma = sigma
+
+	default:
+		return nil, fmt.Errorf("unknown size distribution %q (use uniform or lognormal)", kind)
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	d.rng = rand.New(rand.NewSource(seed))
+
+	// Printable filler keeps the payload valid UTF-8 for text frames
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	d.filler = make([]byte, d.max)
+	for i := range d.filler {
+		d.filler[i] = alphabet[d.rng.Intn(len(alphabet))]
+	}
+
+	return d, nil
+}
+
+// nextSize draws the next payload size
+func (d *sizeDistribution) nextSize() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var size int
+	switch d.kind {
+	case "uniform":
+		size = d.min + d.rng.Intn(d.max-d.min+1)
+	case "lognormal":
+		size = int(math.Round(math.Exp(d.mu + d.sigma*d.rng.NormFloat64())))
+	}
+
+	if size < d.min {
+		size = d.min
+	}
+	if size > d.max {
+		size = d.max
+	}
+	return size
+}
+
+// payload returns a payload whose size is drawn from the distribution
+func (d *sizeDistribution) payload() []byte {
+	return d.filler[:d.nextSize()]
+}
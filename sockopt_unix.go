@@ -0,0 +1,26 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// socketBufferSizes returns the effective kernel receive and send buffer sizes
+func socketBufferSizes(conn *net.TCPConn) (recv, send int, ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	var recvErr, sendErr error
+	err = raw.Control(func(fd uintptr) {
+		recv, recvErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		send, sendErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if err != nil || recvErr != nil || sendErr != nil {
+		return 0, 0, false
+	}
+	return recv, send, true
+}
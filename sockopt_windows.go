@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// socketBufferSizes is not supported on Windows
+func socketBufferSizes(conn *net.TCPConn) (recv, send int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+)
+
+// sparklineWidth caps the width of the results timeline
+const sparklineWidth = 60
+
+// sparklineLevels maps a success rate from 0% to 100% onto block heights
+var sparklineLevels = []rune("▁▂▃▄▅▆▇█")
+
+// timelinePoint is a cumulative snapshot of request outcomes, taken once per
+// second while the test runs
+type timelinePoint struct {
+	Successful int64
+	Failed     int64
+}
+
+// successSparkline renders the per-second success rate between consecutive
+// timeline points as an ASCII sparkline. Seconds are merged so the line is at
+// most width characters wide; the number of seconds per character is returned
+// alongside. Intervals without any completed requests render as a space.
+func successSparkline(timeline []timelinePoint, width int) (string, int) {
+	if len(timeline) == 0 || width <= 0 {
+		return "", 0
+	}
+
+	secondsPerChar := (len(timeline) + width - 1) / width
+
+	var sb strings.Builder
+	var previous timelinePoint
+	for start := 0; start < len(timeline); start += secondsPerChar {
+		end := start + secondsPerChar
+		if end > len(timeline) {
+			end = len(timeline)
+		}
+		current := timeline[end-1]
+
+		successful := current.Successful - previous.Successful
+		failed := current.Failed - previous.Failed
+		previous = current
+
+		total := successful + failed
+		if total <= 0 {
+			sb.WriteRune(' ')
+			continue
+		}
+		level := int(successful * int64(len(sparklineLevels)-1) / total)
+		sb.WriteRune(sparklineLevels[level])
+	}
+
+	return sb.String(), secondsPerChar
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+)
+
+// perSecondRates returns the completed requests in each full second of the
+// timeline. The final point closes a partial second and is excluded.
+func perSecondRates(timeline []timelinePoint) []float64 {
+	if len(timeline) < 2 {
+		return nil
+	}
+
+	rates := make([]float64, 0, len(timeline)-1)
+	var previous int64
+	for _, point := range timeline[:len(timeline)-1] {
+		completed := point.Successful + point.Failed
+		rates = append(rates, float64(completed-previous))
+		previous = completed
+	}
+	return rates
+}
+
+// rpsCoefficientOfVariation returns the standard deviation of the per-second
+// request rate divided by its mean. It reports false when there are fewer
+// than two full seconds or no requests completed.
+func rpsCoefficientOfVariation(timeline []timelinePoint) (float64, bool) {
+	rates := perSecondRates(timeline)
+	if len(rates) < 2 {
+		return 0, false
+	}
+
+	var sum float64
+	for _, rate := range rates {
+		sum += rate
+	}
+	mean := sum / float64(len(rates))
+	if mean == 0 {
+		return 0, false
+	}
+
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	variance /= float64(len(rates))
+
+	return math.Sqrt(variance) / mean, true
+}
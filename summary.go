@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ResultSummary is a snapshot of the metrics of a finished test, for callers
+// that consume results programmatically instead of reading the printed report.
+// In JSON the durations are plain numbers in the --latency-unit, named after
+// it (see MarshalJSON).
+type ResultSummary struct {
+	StartTime        time.Time                `json:"start_time"`
+	EndTime          time.Time                `json:"end_time"`
+	Duration         time.Duration            `json:"duration_ns"`
+	TotalRequests    int64                    `json:"total_requests"`
+	SuccessfulReqs   int64                    `json:"successful_requests"`
+	FailedReqs       int64                    `json:"failed_requests"`
+	CancelledReqs    int64                    `json:"cancelled_requests"`
+	SuccessRate      float64                  `json:"success_rate"`
+	RequestsPerSec   float64                  `json:"requests_per_sec"`
+	AvgLatency       time.Duration            `json:"avg_latency_ns"`
+	PeakLatency      time.Duration            `json:"peak_latency_ns"`
+	Percentiles      map[string]time.Duration `json:"latency_percentiles_ns"`
+	Throughput       float64                  `json:"throughput_bytes_sec"`
+	BytesSent        int64                    `json:"bytes_sent"`
+	BytesReceived    int64                    `json:"bytes_received"`
+	MessagesReceived int64                    `json:"messages_received"`
+	EstablishedConns int64                    `json:"established_connections"`
+	ErrorCounts      map[string]int           `json:"error_counts"`
+	ErrorCategories  map[string]int           `json:"error_categories"`
+	AbortReason      string                   `json:"abort_reason,omitempty"`
+
+	latencyUnit string
+}
+
+// Results summarizes the test once Run has returned. The summary is a copy,
+// so it stays valid and unchanged if the caller keeps it.
+func (lt *LoadTest) Results() *ResultSummary {
+	lt.results.mu.RLock()
+	defer lt.results.mu.RUnlock()
+
+	r := lt.results
+	summary := &ResultSummary{
+		StartTime:        r.StartTime,
+		EndTime:          r.EndTime,
+		Duration:         r.EndTime.Sub(r.StartTime),
+		TotalRequests:    r.TotalRequests,
+		SuccessfulReqs:   r.SuccessfulReqs,
+		FailedReqs:       r.FailedReqs,
+		CancelledReqs:    r.CancelledReqs,
+		PeakLatency:      r.PeakResponseTime,
+		Percentiles:      make(map[string]time.Duration, len(lt.opts.Percentiles)),
+		BytesSent:        r.BytesSent,
+		BytesReceived:    r.BytesReceived,
+		MessagesReceived: r.MessagesReceived,
+		EstablishedConns: r.EstablishedConns,
+		ErrorCounts:      make(map[string]int, len(r.ErrorCounts)),
+		ErrorCategories:  make(map[string]int),
+		AbortReason:      lt.abortReason,
+		latencyUnit:      lt.opts.LatencyUnit,
+	}
+
+	if r.TotalRequests > 0 {
+		summary.SuccessRate = float64(r.SuccessfulReqs) / float64(r.TotalRequests) * 100
+	}
+	if seconds := summary.Duration.Seconds(); seconds > 0 {
+		summary.RequestsPerSec = float64(r.TotalRequests) / seconds
+		summary.Throughput = float64(r.BytesSent+r.BytesReceived) / seconds
+	}
+	summary.AvgLatency = r.avgLatency()
+
+	for i, latency := range lt.latencyPercentiles(lt.opts.Percentiles) {
+		summary.Percentiles[percentileLabel(lt.opts.Percentiles[i])] = latency
+	}
+
+	for errorType, count := range r.ErrorCounts {
+		summary.ErrorCounts[errorType] = count
+	}
+	for category, info := range r.ErrorCategories {
+		if info.Count > 0 {
+			summary.ErrorCategories[category] = info.Count
+		}
+	}
+
+	return summary
+}
+
+// MarshalJSON writes the summary with its durations in the --latency-unit, as
+// numbers with that unit's precision, e.g. "avg_latency_ms": 12.345. The
+// fields keep their declared order.
+func (s ResultSummary) MarshalJSON() ([]byte, error) {
+	unit := s.latencyUnit
+	if _, ok := latencyUnits[unit]; !ok {
+		unit = "ms"
+	}
+	latency := func(d time.Duration) json.Number {
+		return json.Number(strings.TrimSuffix(formatLatency(d, unit), unit))
+	}
+	percentiles := make(map[string]json.Number, len(s.Percentiles))
+	for label, d := range s.Percentiles {
+		percentiles[label] = latency(d)
+	}
+
+	type field struct {
+		key   string
+		value any
+	}
+	fields := []field{
+		{"start_time", s.StartTime},
+		{"end_time", s.EndTime},
+		{"duration_" + unit, latency(s.Duration)},
+		{"total_requests", s.TotalRequests},
+		{"successful_requests", s.SuccessfulReqs},
+		{"failed_requests", s.FailedReqs},
+		{"cancelled_requests", s.CancelledReqs},
+		{"success_rate", s.SuccessRate},
+		{"requests_per_sec", s.RequestsPerSec},
+		{"avg_latency_" + unit, latency(s.AvgLatency)},
+		{"peak_latency_" + unit, latency(s.PeakLatency)},
+		{"latency_percentiles_" + unit, percentiles},
+		{"throughput_bytes_sec", s.Throughput},
+		{"bytes_sent", s.BytesSent},
+		{"bytes_received", s.BytesReceived},
+		{"messages_received", s.MessagesReceived},
+		{"established_connections", s.EstablishedConns},
+		{"error_counts", s.ErrorCounts},
+		{"error_categories", s.ErrorCategories},
+	}
+	if s.AbortReason != "" {
+		fields = append(fields, field{"abort_reason", s.AbortReason})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%q:%s", field.key, value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSONResults writes the results as one indented JSON object for
+// --output json
+func (lt *LoadTest) writeJSONResults(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(lt.Results())
+}
+
+// summaryLine renders the results as one greppable line for --output line,
+// prefixed OK or FAIL by the verdict of the pass/fail gates
+func (lt *LoadTest) summaryLine(passed bool) string {
+	summary := lt.Results()
+	lt.results.mu.RLock()
+	p95 := lt.latencyPercentiles([]float64{95})[0]
+	lt.results.mu.RUnlock()
+
+	verdict := "OK"
+	if !passed {
+		verdict = "FAIL"
+	}
+	return fmt.Sprintf("%s rps=%.0f p95=%s success=%.1f%% errors=%d",
+		verdict, summary.RequestsPerSec, formatLatency(p95, lt.opts.LatencyUnit), summary.SuccessRate, summary.FailedReqs)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// messageTemplateData holds the per-message values available to a
+// --json-template, e.g. {{.ConnID}} and {{.MsgID}}
+type messageTemplateData struct {
+	ConnID int
+	MsgID  int
+	Seq    uint64
+}
+
+// messageTemplateFuncs are the generator functions available to templates
+var messageTemplateFuncs = template.FuncMap{
+	"uuid": generateUUID,
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	},
+	"unixMilli": func() int64 {
+		return time.Now().UnixMilli()
+	},
+}
+
+// generateUUID returns a random RFC 4122 version 4 UUID
+func generateUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000-0000-4000-8000-000000000000"
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// compileMessageTemplate parses a message template and checks that a rendered
+// sample is valid JSON. The raw template is not JSON until its placeholders
+// are expanded, so validation has to run on the output.
+func compileMessageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("message").Funcs(messageTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON template: %v", err)
+	}
+
+	sample, err := renderMessageTemplate(tmpl, messageTemplateData{})
+	if err != nil {
+		return nil, err
+	}
+	if !isValidJSON(string(sample)) {
+		return nil, fmt.Errorf("JSON template does not render valid JSON: %s", sanitizeMessage(string(sample), 100))
+	}
+
+	return tmpl, nil
+}
+
+// renderMessageTemplate expands a compiled message template
+func renderMessageTemplate(tmpl *template.Template, data messageTemplateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render JSON template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	// bannerWidth is the width of the title boxes on a wide terminal
+	bannerWidth = 64
+
+	// minBannerWidth is the narrowest terminal that still gets a box; below
+	// it titles are printed as plain text
+	minBannerWidth = 24
+)
+
+// terminalWidth returns the width of the terminal stdout is attached to, or
+// 0 when it is unknown (e.g. output is piped). $COLUMNS takes precedence so
+// the layout can be forced.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 0
+}
+
+// printBanner prints title in a box that fits the terminal
+func printBanner(title string) {
+	fmt.Print(formatBanner(title, terminalWidth()))
+}
+
+// formatBanner renders title centered in a box no wider than width columns
+// (0 means unlimited); very narrow terminals get the bare title
+func formatBanner(title string, width int) string {
+	boxWidth := bannerWidth
+	if width > 0 && width < boxWidth {
+		boxWidth = width
+	}
+	inner := boxWidth - 2
+	titleWidth := utf8.RuneCountInString(title)
+	if boxWidth < minBannerWidth || titleWidth > inner {
+		return title + "\n"
+	}
+
+	left := (inner - titleWidth) / 2
+	right := inner - titleWidth - left
+	return "╔" + strings.Repeat("═", inner) + "╗\n" +
+		"║" + strings.Repeat(" ", left) + title + strings.Repeat(" ", right) + "║\n" +
+		"╚" + strings.Repeat("═", inner) + "╝\n"
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// urlTokenExpiry finds the earliest expiry among the signed credentials in
+// the URL query string, as used by cloud WebSocket services:
+//
+//   - JWT access tokens (e.g. Azure Web PubSub ?access_token=...) via "exp"
+//   - AWS SigV4 presigned URLs via X-Amz-Date plus X-Amz-Expires
+//   - Azure SAS tokens via "se" (signed expiry)
+//
+// It returns the query parameter the expiry came from.
+func urlTokenExpiry(rawURL string) (string, time.Time, bool) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	query := parsedURL.Query()
+
+	var param string
+	var earliest time.Time
+	found := func(name string, expiry time.Time) {
+		if param == "" || expiry.Before(earliest) {
+			param, earliest = name, expiry
+		}
+	}
+
+	for name, values := range query {
+		for _, value := range values {
+			if expiry, ok := jwtExpiry(value); ok {
+				found(name, expiry)
+			}
+		}
+	}
+
+	if signed, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date")); err == nil {
+		if seconds, err := strconv.Atoi(query.Get("X-Amz-Expires")); err == nil {
+			found("X-Amz-Expires", signed.Add(time.Duration(seconds)*time.Second))
+		}
+	}
+
+	if se := query.Get("se"); se != "" {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z", "2006-01-02"} {
+			if expiry, err := time.Parse(layout, se); err == nil {
+				found("se", expiry)
+				break
+			}
+		}
+	}
+
+	return param, earliest, param != ""
+}
+
+// jwtExpiry returns the "exp" claim of a JWT without verifying its signature
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(*claims.Exp), 0), true
+}
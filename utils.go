@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 	"sort"
+	"strconv"
+	"unicode/utf8"
 )
 
 // isValidJSON checks if a string is valid JSON
@@ -59,6 +63,28 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh%dm", hours, minutes)
 }
 
+// latencyUnits maps each --latency-unit to its size and the decimals printed;
+// every unit resolves to at least the microsecond
+var latencyUnits = map[string]struct {
+	size     time.Duration
+	decimals int
+}{
+	"s":  {time.Second, 6},
+	"ms": {time.Millisecond, 3},
+	"us": {time.Microsecond, 0},
+	"ns": {time.Nanosecond, 0},
+}
+
+// formatLatency formats a latency as a plain number in unit with a fixed
+// precision, e.g. "1.235ms"; unknown units fall back to milliseconds
+func formatLatency(d time.Duration, unit string) string {
+	u, ok := latencyUnits[unit]
+	if !ok {
+		unit, u = "ms", latencyUnits["ms"]
+	}
+	return strconv.FormatFloat(float64(d)/float64(u.size), 'f', u.decimals, 64) + unit
+}
+
 // formatBytes formats bytes in a human-readable way
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -73,8 +99,11 @@ func formatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// calculatePercentile calculates the nth percentile from a slice of durations
-func calculatePercentile(latencies []time.Duration, percentile int) time.Duration {
+// calculatePercentile calculates the nth percentile from a slice of durations;
+// fractional percentiles such as 99.9 are supported. Values between ranks are
+// linearly interpolated (the R-7 / Excel PERCENTILE.INC method), so small
+// samples are not biased towards the next larger element.
+func calculatePercentile(latencies []time.Duration, percentile float64) time.Duration {
 	if len(latencies) == 0 {
 		return 0
 	}
@@ -84,35 +113,344 @@ func calculatePercentile(latencies []time.Duration, percentile int) time.Duratio
 		return latencies[i] < latencies[j]
 	})
 
-	// Calculate index for percentile
-	index := (percentile * len(latencies)) / 100
-	if index >= len(latencies) {
-		index = len(latencies) - 1
+	// Position of the percentile between the first (0) and last (n-1) rank
+	rank := percentile / 100 * float64(len(latencies)-1)
+	lower := int(rank)
+	if lower >= len(latencies)-1 {
+		return latencies[len(latencies)-1]
 	}
+	fraction := rank - float64(lower)
 
-	return latencies[index]
+	return latencies[lower] + time.Duration(fraction*float64(latencies[lower+1]-latencies[lower]))
 }
 
 // validateTestOptions validates the test configuration options
 func validateTestOptions(opts *TestOptions) error {
 	// Validate URL
+	if opts.URL == "" {
+		return fmt.Errorf("URL is required (use -u/--url or --replay)")
+	}
 	if _, err := validateWebSocketURL(opts.URL); err != nil {
 		return fmt.Errorf("URL validation failed: %v", err)
 	}
 
 	// Validate duration
-	if _, err := time.ParseDuration(opts.Duration); err != nil {
+	duration, err := time.ParseDuration(opts.Duration)
+	if err != nil {
 		return fmt.Errorf("invalid duration format: %v", err)
 	}
 
+	// Catch signed URL credentials that expire before the test ends, which
+	// would surface as handshake failures misattributed to the server
+	if param, expiry, ok := urlTokenExpiry(opts.URL); ok {
+		if end := time.Now().Add(duration); expiry.Before(end) {
+			problem := fmt.Sprintf("the token in URL parameter %s expires at %s, before the test ends at %s",
+				param, expiry.Local().Format("15:04:05"), end.Format("15:04:05"))
+			if !expiry.After(time.Now()) {
+				problem = fmt.Sprintf("the token in URL parameter %s expired at %s", param, expiry.Local().Format("2006-01-02 15:04:05"))
+			}
+			if opts.Strict {
+				return fmt.Errorf("%s", problem)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %s (use --strict to reject)\n", problem)
+		}
+	}
+
 	// Validate connections
 	if opts.Connections <= 0 {
 		return fmt.Errorf("connections must be greater than 0")
 	}
 
-	// Validate loop count
-	if opts.Loop <= 0 {
-		return fmt.Errorf("loop count must be greater than 0")
+	// Validate loop count; --continuous is stored as --loop 0, so history and
+	// --replay see a single setting
+	if opts.Continuous {
+		if opts.Loop != 1 && opts.Loop != 0 {
+			return fmt.Errorf("--continuous sends until the duration ends and cannot be used with --loop")
+		}
+		opts.Loop = 0
+	}
+	if opts.Loop < 0 {
+		return fmt.Errorf("loop count cannot be negative (use 0 or --continuous to send until the duration ends)")
+	}
+
+	// Validate the shared request count
+	if opts.Requests < 0 {
+		return fmt.Errorf("--requests cannot be negative")
+	}
+	if opts.Requests > 0 {
+		if opts.Loop != 1 {
+			return fmt.Errorf("--requests sets the total message count and cannot be used with --loop or --continuous")
+		}
+		if opts.SendOnConnectOnly || opts.DebugSingle {
+			return fmt.Errorf("--requests cannot be combined with --send-on-connect-only or --debug-single")
+		}
+	}
+
+	// Validate timeouts
+	if opts.HandshakeTimeout < 0 || opts.TCPConnectTimeout < 0 || opts.ReadTimeout < 0 || opts.WriteTimeout < 0 || opts.DrainTimeout < 0 || opts.ResponseTimeout < 0 || opts.IdleTimeout < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
+	}
+
+	// Validate the synchronized start
+	if opts.StartAt != "" && opts.StartDelay != 0 {
+		return fmt.Errorf("use either --start-at or --start-delay, not both")
+	}
+	if opts.StartDelay < 0 {
+		return fmt.Errorf("--start-delay cannot be negative")
+	}
+	if _, _, err := opts.startTime(time.Now()); err != nil {
+		return err
+	}
+
+	// Validate the closed-loop concurrency target; a request only completes
+	// when its response arrives, which needs --response-timeout
+	if opts.TargetConcurrency < 0 {
+		return fmt.Errorf("--target-concurrency cannot be negative")
+	}
+	if opts.TargetConcurrency > 0 && opts.ResponseTimeout <= 0 {
+		return fmt.Errorf("--target-concurrency needs --response-timeout to know when a request completes")
+	}
+
+	// Validate connect-phase abort threshold
+	if opts.MaxConnectFailures < 0 {
+		return fmt.Errorf("--max-connect-failures cannot be negative")
+	}
+
+	// Validate the per-connection send rate
+	if opts.Rate < 0 {
+		return fmt.Errorf("--rate cannot be negative")
+	}
+
+	// Validate ramp-up window
+	if opts.RampUp < 0 {
+		return fmt.Errorf("ramp-up cannot be negative")
+	}
+	if opts.RampUp > duration {
+		return fmt.Errorf("ramp-up (%s) cannot exceed the test duration (%s)", opts.RampUp, duration)
+	}
+
+	// Validate ramp-down window
+	if opts.RampDown < 0 {
+		return fmt.Errorf("ramp-down cannot be negative")
+	}
+	if opts.RampDown > duration {
+		return fmt.Errorf("ramp-down (%s) cannot exceed the test duration (%s)", opts.RampDown, duration)
+	}
+	if opts.RampUp+opts.RampDown > duration {
+		return fmt.Errorf("ramp-up (%s) and ramp-down (%s) together cannot exceed the test duration (%s)", opts.RampUp, opts.RampDown, duration)
+	}
+
+	// Validate stability threshold
+	if opts.MaxRPSCoV < 0 {
+		return fmt.Errorf("--max-rps-cov cannot be negative")
+	}
+
+	// Validate the availability SLO; 100% would leave no error budget
+	if opts.SLOAvailability < 0 || opts.SLOAvailability >= 100 {
+		return fmt.Errorf("--slo-availability must be a percentage below 100 (e.g. 99.9)")
+	}
+
+	// Validate connection lifetime
+	if opts.ConnectionLifetime < 0 {
+		return fmt.Errorf("connection lifetime cannot be negative")
+	}
+
+	// Validate DNS overrides
+	if _, err := parseResolveOverrides(opts.Resolve); err != nil {
+		return err
+	}
+
+	// Validate socket buffer size
+	if opts.SocketBuffer < 0 {
+		return fmt.Errorf("socket buffer size cannot be negative")
+	}
+
+	// Validate send queue size
+	if opts.SendQueueSize < 0 {
+		return fmt.Errorf("send queue size cannot be negative")
+	}
+
+	// Validate replay comparison
+	if opts.Compare && opts.Replay == 0 {
+		return fmt.Errorf("--compare requires --replay")
+	}
+
+	// Validate regression threshold
+	if opts.MaxRegression < 0 {
+		return fmt.Errorf("--max-regression cannot be negative")
+	}
+
+	// Validate first message
+	if opts.AwaitFirstResponse && opts.FirstMessage == "" {
+		return fmt.Errorf("--await-first-response requires --first-message")
+	}
+
+	// Read --message-file once, so sending costs no file I/O
+	if opts.MessageFile != "" {
+		if opts.messageSet || opts.MessageEncoding == "base64" {
+			return fmt.Errorf("--message-file cannot be combined with --message or --message-encoding base64")
+		}
+		if opts.JSONTemplate != "" || opts.MessagesFile != "" || opts.SizeDist != "" || opts.Fuzz || opts.MessageCommand != "" {
+			return fmt.Errorf("--message-file cannot be combined with --json-template, --messages-file, --size-dist, --fuzz or --message-command")
+		}
+		data, err := os.ReadFile(opts.MessageFile)
+		if err != nil {
+			return fmt.Errorf("cannot read --message-file: %v", err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("--message-file %s is empty", opts.MessageFile)
+		}
+		opts.messageFile = data
+	}
+
+	// Text frames must carry valid UTF-8 (RFC 6455), otherwise servers close
+	// the connection with a protocol error
+	if !opts.Binary {
+		if !utf8.ValidString(opts.Message) {
+			return fmt.Errorf("message is not valid UTF-8 and cannot be sent as a text frame (use --binary)")
+		}
+		if !utf8.ValidString(opts.FirstMessage) {
+			return fmt.Errorf("first message is not valid UTF-8 and cannot be sent as a text frame (use --binary)")
+		}
+	}
+
+	// Validate pub/sub mode
+	if opts.SendOnConnectOnly {
+		if opts.ResponseTimeout > 0 {
+			return fmt.Errorf("--response-timeout needs request/response traffic and cannot be used with --send-on-connect-only")
+		}
+		if opts.IdleTimeout > 0 {
+			return fmt.Errorf("--idle-timeout needs request/response traffic and cannot be used with --send-on-connect-only (use --read-timeout)")
+		}
+		if opts.Loop != 1 {
+			return fmt.Errorf("--send-on-connect-only sends one message per connection and cannot be used with --loop or --continuous")
+		}
+		if opts.ValidateEcho || opts.Fuzz {
+			return fmt.Errorf("--send-on-connect-only cannot be combined with --validate-echo or --fuzz")
+		}
+	}
+
+	// Validate the fan-out expectation
+	if opts.ExpectReceived < 0 {
+		return fmt.Errorf("--expect-received cannot be negative")
+	}
+	if opts.ExactReceived && opts.ExpectReceived == 0 {
+		return fmt.Errorf("--expect-received-exact requires --expect-received")
+	}
+
+	// Validate the single-connection trace
+	if opts.DebugSingle && (opts.Fuzz || opts.SendOnConnectOnly) {
+		return fmt.Errorf("--debug-single cannot be combined with --fuzz or --send-on-connect-only")
+	}
+
+	// Validate the message corpus
+	if opts.MessagesFile != "" {
+		if opts.JSONTemplate != "" || opts.SizeDist != "" || opts.Fuzz || opts.MessageCommand != "" {
+			return fmt.Errorf("--messages-file cannot be combined with --json-template, --size-dist, --fuzz or --message-command")
+		}
+	}
+
+	// Validate JSON-only mode; generated payloads are checked as they are built
+	if opts.StrictJSON {
+		if opts.MessageEncoding == "base64" || opts.SizeDist != "" || opts.Fuzz {
+			return fmt.Errorf("--strict-json cannot be combined with --message-encoding base64, --size-dist or --fuzz")
+		}
+		if opts.MessageFile != "" && !isValidJSON(string(opts.messageFile)) {
+			return fmt.Errorf("--message-file %s is not valid JSON (--strict-json)", opts.MessageFile)
+		}
+		if opts.JSONTemplate == "" && opts.MessagesFile == "" && opts.MessageCommand == "" && opts.MessageFile == "" && !isValidJSON(opts.Message) {
+			return fmt.Errorf("message is not valid JSON (--strict-json): %s", sanitizeMessage(opts.Message, 100))
+		}
+		if opts.FirstMessage != "" && !isValidJSON(opts.FirstMessage) {
+			return fmt.Errorf("first message is not valid JSON (--strict-json): %s", sanitizeMessage(opts.FirstMessage, 100))
+		}
+	}
+
+	// Validate the external payload generator
+	if opts.MessageCommand != "" {
+		if opts.JSONTemplate != "" || opts.SizeDist != "" || opts.Fuzz {
+			return fmt.Errorf("--message-command cannot be combined with --json-template, --size-dist or --fuzz")
+		}
+		if opts.CommandTimeout <= 0 {
+			return fmt.Errorf("--message-command-timeout must be positive")
+		}
+	}
+
+	// Validate fragmentation; --fuzz writes its own frames
+	if opts.FrameSize < 0 {
+		return fmt.Errorf("--frame-size cannot be negative")
+	}
+	if opts.FrameSize > 0 && opts.Fuzz {
+		return fmt.Errorf("--frame-size cannot be combined with --fuzz")
+	}
+
+	// Validate fuzzing mode
+	if opts.Fuzz {
+		if opts.ValidateEcho || opts.JSONTemplate != "" || opts.SizeDist != "" {
+			return fmt.Errorf("--fuzz cannot be combined with --validate-echo, --json-template or --size-dist")
+		}
+		if opts.FuzzCorpus != "" {
+			if info, err := os.Stat(opts.FuzzCorpus); err != nil || !info.IsDir() {
+				return fmt.Errorf("--fuzz-corpus %s is not a readable directory", opts.FuzzCorpus)
+			}
+		}
+	} else if opts.FuzzCorpus != "" {
+		return fmt.Errorf("--fuzz-corpus requires --fuzz")
+	}
+
+	// Validate remote-write endpoint and headers
+	if opts.RemoteWrite != "" {
+		if _, err := newRemoteWriter(opts.RemoteWrite, opts.RemoteWriteHeaders); err != nil {
+			return err
+		}
+	} else if len(opts.RemoteWriteHeaders) > 0 {
+		return fmt.Errorf("--remote-write-header requires --remote-write")
+	}
+
+	// Validate history retention policy
+	if opts.Retention != "" {
+		if _, err := parseRetention(opts.Retention); err != nil {
+			return err
+		}
+	}
+
+	// Templated messages are validated on a rendered sample
+	if opts.JSONTemplate != "" {
+		if _, err := compileMessageTemplate(opts.JSONTemplate); err != nil {
+			return err
+		}
+	}
+
+	// Validate size distribution
+	message, err := decodeMessage(opts)
+	if err != nil {
+		return err
+	}
+	largestMessage := len(message)
+	if opts.SizeDist != "" {
+		if opts.JSONTemplate != "" {
+			return fmt.Errorf("--size-dist and --json-template cannot be used together")
+		}
+		dist, err := parseSizeDistribution(opts.SizeDist, opts.Seed)
+		if err != nil {
+			return err
+		}
+		largestMessage = dist.max
+	}
+
+	// Catch accidentally huge payloads before they distort throughput numbers
+	if opts.WarnMessageSize > 0 && largestMessage > opts.WarnMessageSize {
+		problem := fmt.Sprintf("message size %s exceeds the %s warning threshold",
+			formatBytes(int64(largestMessage)), formatBytes(int64(opts.WarnMessageSize)))
+		if opts.Strict {
+			return fmt.Errorf("%s", problem)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s (use --strict to reject)\n", problem)
+	}
+
+	// The file's contents are sent as they are, binary or not
+	if opts.MessageFile != "" {
+		return nil
 	}
 
 	// Validate message (check if it's valid JSON if it looks like JSON)
@@ -121,8 +459,8 @@ func validateTestOptions(opts *TestOptions) error {
 	}
 
 	// If message looks like JSON, validate it
-	if strings.HasPrefix(strings.TrimSpace(opts.Message), "{") || 
-	   strings.HasPrefix(strings.TrimSpace(opts.Message), "[") {
+	if opts.MessageEncoding != "base64" && (strings.HasPrefix(strings.TrimSpace(opts.Message), "{") ||
+		strings.HasPrefix(strings.TrimSpace(opts.Message), "[")) {
 		if !isValidJSON(opts.Message) {
 			return fmt.Errorf("message appears to be JSON but is not valid: %s", opts.Message)
 		}
@@ -131,6 +469,60 @@ func validateTestOptions(opts *TestOptions) error {
 	return nil
 }
 
+// validateHistoryOptions validates the history command options
+func validateHistoryOptions(opts *HistoryOptions) error {
+	if opts.File != "" && opts.Export == "" {
+		return fmt.Errorf("--file requires --export")
+	}
+	if opts.Prune {
+		if opts.Retention == "" {
+			return fmt.Errorf("--prune requires --retention")
+		}
+		if _, err := parseRetention(opts.Retention); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visualizeMetrics are the history metrics the visualize command can chart
+var visualizeMetrics = []string{"success-rate", "requests-per-sec", "avg-latency", "p90-latency", "p95-latency", "p99-latency", "throughput"}
+
+// validateVisualizeOptions validates the visualize command options
+func validateVisualizeOptions(opts *VisualizeOptions) error {
+	for _, metric := range visualizeMetrics {
+		if opts.Metric == metric {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid metric: %s. Valid options: %s", opts.Metric, strings.Join(visualizeMetrics, ", "))
+}
+
+// decodeMessage returns the bytes to send for --message, decoding it first
+// when --message-encoding base64 is used, or the --message-file contents
+func decodeMessage(opts *TestOptions) ([]byte, error) {
+	if opts.messageFile != nil {
+		return opts.messageFile, nil
+	}
+	if opts.MessageEncoding != "base64" {
+		return []byte(opts.Message), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(opts.Message))
+	if err != nil {
+		return nil, fmt.Errorf("message is not valid base64: %v", err)
+	}
+	return decoded, nil
+}
+
+// binaryFrames reports whether messages are sent as binary frames: with
+// --binary, base64-encoded messages, or a --message-file that is not UTF-8
+func binaryFrames(opts *TestOptions) bool {
+	if opts.messageFile != nil && !utf8.Valid(opts.messageFile) {
+		return true
+	}
+	return opts.Binary || opts.MessageEncoding == "base64"
+}
+
 // sanitizeMessage ensures the message is safe to display
 func sanitizeMessage(message string, maxLength int) string {
 	if len(message) <= maxLength {